@@ -1,40 +1,252 @@
 package distributed_cache
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"maps"
+	"mime"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"distributed-cache/consistenthash"
 	pb "distributed-cache/gen/v1"
+	"distributed-cache/placement"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 )
 
 const (
 	defaultBasePath = "/cache/"
 	defaultReplicas = 50
+	// healthPath answers the health checks of other peers, outside the
+	// base path so that it needs no group.
+	healthPath = "/_health"
+	// expireHeader carries a value's expiry as unix nanoseconds so that
+	// peers agree on it exactly.
+	expireHeader = "X-Cache-Expire"
+	// notFoundHeader tells a 404 for a key the origin doesn't have apart
+	// from one for an unknown group or path.
+	notFoundHeader = "X-Cache-Not-Found"
+	// forwardedHeader marks requests sent by a peer, which the receiver
+	// serves itself instead of picking a peer again.
+	forwardedHeader = "X-Cache-Forwarded"
+
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+	contentTypeBytes    = "application/octet-stream"
 )
 
 // HTTPPool implements PeerPicker for a pool of HTTP peers.
 type HTTPPool struct {
 	// this peer's base URL, e.g. "https://example.net:8000"
-	self        string
-	basePath    string
+	self     string
+	basePath string
+	// mu serializes membership changes; PickPeer reads the placement and
+	// the getters without it, as both are replaced rather than modified.
 	mu          sync.Mutex
-	peers       *consistenthash.Map
-	httpGetters map[string]*httpGetter
+	weights     map[string]int
+	peers       placement.Placement
+	httpGetters atomic.Pointer[map[string]*httpGetter]
+	// available holds the weights last given to the placement: those of
+	// the peers whose circuit is not open
+	available map[string]int
+
+	// breakAfter enables the circuit breakers of the getters when above 0
+	breakAfter int
+	breakFor   time.Duration
+	// client sends the requests of the getters; nil means
+	// http.DefaultClient
+	client *http.Client
+	// stopChecks and checksDone end the health checks started by
+	// StartHealthChecks
+	stopChecks chan struct{}
+	checksDone chan struct{}
+
+	// loadFactor enables bounded loads when above 1; serving counts the
+	// requests this peer serves itself, those forwarded here and the loads
+	// from its groups' getters, its own load
+	loadFactor float64
+	serving    atomic.Int64
+	// readReplicas is how many peers PickPeers returns at most
+	readReplicas int
 }
 
-// NewHTTPPool initializes an HTTP pool of peers.
+// HTTPPoolOptions are the configurations of a HTTPPool.
+type HTTPPoolOptions struct {
+	// BasePath specifies the HTTP path that will serve cache requests.
+	// If blank, it defaults to "/cache/".
+	BasePath string
+
+	// Replicas specifies the number of virtual nodes per peer on the
+	// consistent hash ring. If blank, it defaults to 50.
+	Replicas int
+
+	// HashFn specifies the hash function of the consistent hash ring.
+	// If blank, it defaults to crc32.ChecksumIEEE.
+	HashFn consistenthash.Hash
+
+	// Transport carries the requests to peers. If nil, a copy of
+	// http.DefaultTransport is used when MaxIdleConnsPerHost is set, and
+	// http.DefaultTransport otherwise.
+	Transport http.RoundTripper
+
+	// Timeout bounds each request to a peer, including reading the
+	// response. Zero means no timeout.
+	Timeout time.Duration
+
+	// MaxIdleConnsPerHost is the number of keep-alive connections kept
+	// per peer when Transport is nil. If blank, it defaults to that of
+	// http.DefaultTransport.
+	MaxIdleConnsPerHost int
+}
+
+// NewHTTPPool initializes an HTTP pool of peers placed on a consistent
+// hash ring.
 func NewHTTPPool(self string) *HTTPPool {
+	return NewHTTPPoolOpts(self, nil)
+}
+
+// NewHTTPPoolOpts initializes an HTTP pool of peers with the given
+// options; nil means the defaults.
+func NewHTTPPoolOpts(self string, o *HTTPPoolOptions) *HTTPPool {
+	var opts HTTPPoolOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.Replicas == 0 {
+		opts.Replicas = defaultReplicas
+	}
+	p := NewHTTPPoolWithPlacement(self, placement.NewRing(opts.Replicas, opts.HashFn))
+	if opts.BasePath != "" {
+		p.basePath = "/"
+		// a base path of "/" serves cache requests at the root
+		if trimmed := strings.Trim(opts.BasePath, "/"); trimmed != "" {
+			p.basePath += trimmed + "/"
+		}
+	}
+	transport := opts.Transport
+	if transport == nil && opts.MaxIdleConnsPerHost > 0 {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+		transport = t
+	}
+	if transport != nil || opts.Timeout > 0 {
+		p.client = &http.Client{Transport: transport, Timeout: opts.Timeout}
+	}
+	return p
+}
+
+// NewHTTPPoolWithPlacement initializes an HTTP pool of peers that picks
+// the owner of a key with pl. Every peer must use the same algorithm.
+func NewHTTPPoolWithPlacement(self string, pl placement.Placement) *HTTPPool {
 	return &HTTPPool{
 		self:     self,
 		basePath: defaultBasePath,
+		weights:  make(map[string]int),
+		peers:    pl,
+	}
+}
+
+// SetCircuitBreaker makes the pool stop sending requests to a peer after
+// threshold consecutive failures and take it out of the placement for
+// cooldown. A single request then tests the peer, and puts it back in the
+// placement if it succeeds. The breaker is off by default, and a threshold
+// of 0 turns it off again. It must be called before peers are added.
+//
+// Groups using the pool should leave PeerFailurePolicy.BreakAfter at 0, so
+// that failures are counted once; they pass over peers the pool turns away
+// without counting it against them.
+func (p *HTTPPool) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	p.breakAfter = threshold
+	p.breakFor = cooldown
+}
+
+// StartHealthChecks probes every peer's health endpoint each interval,
+// until StopHealthChecks is called. Failed probes count toward opening a
+// peer's circuit like failed requests, and a successful one closes it, so
+// that peers come back as soon as they answer. Probes need the circuit
+// breaker of SetCircuitBreaker; without it they only log failures.
+func (p *HTTPPool) StartHealthChecks(interval time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopChecks != nil {
+		return
 	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	p.stopChecks, p.checksDone = stop, done
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.checkHealth(interval)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopHealthChecks stops the health checks started by StartHealthChecks
+// and waits for a round in progress to finish.
+func (p *HTTPPool) StopHealthChecks() {
+	p.mu.Lock()
+	stop, done := p.stopChecks, p.checksDone
+	p.stopChecks, p.checksDone = nil, nil
+	p.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// checkHealth probes the other peers at once, each within timeout.
+func (p *HTTPPool) checkHealth(timeout time.Duration) {
+	var wg sync.WaitGroup
+	for peer, g := range p.getters() {
+		if peer == p.self {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			if err := g.probe(ctx); err != nil {
+				p.Log("Health check of %s failed: %v", peer, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// SetLoadFactor makes the pool pick peers with consistent hashing with
+// bounded loads: a peer with more than c times its share of the requests
+// in flight is passed over for the next one on the ring. c must be above
+// 1, e.g. 1.25; 0 turns it off. It has no effect unless the placement
+// implements placement.BoundedLoad, and must be called before the pool is
+// used.
+func (p *HTTPPool) SetLoadFactor(c float64) {
+	p.loadFactor = c
+}
+
+// SetReadReplicas makes PickPeers return up to n replicas of a key, which
+// Group tries in order when the owner fails. It has no effect unless the
+// placement implements placement.Replicas, and must be called before the
+// pool is used.
+func (p *HTTPPool) SetReadReplicas(n int) {
+	p.readReplicas = n
 }
 
 // Log info with server name
@@ -44,6 +256,10 @@ func (p *HTTPPool) Log(format string, v ...interface{}) {
 
 // ServeHTTP handle all http requests
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == healthPath {
+		p.serveHealth(w, r)
+		return
+	}
 	if !strings.HasPrefix(r.URL.Path, p.basePath) {
 		http.Error(w, "unexpected path: "+r.URL.Path, http.StatusNotFound)
 		return
@@ -58,6 +274,12 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	groupName := parts[0]
 	key := parts[1]
+	ctx := r.Context()
+	if r.Header.Get(forwardedHeader) != "" {
+		ctx = serveLocally(ctx)
+		p.serving.Add(1)
+		defer p.serving.Add(-1)
+	}
 
 	group := GetGroup(groupName)
 	if group == nil {
@@ -65,28 +287,210 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	view, err := group.Get(key)
+	switch r.Method {
+	case http.MethodGet:
+		group.stats.ServerRequests.Add(1)
+		view, err := group.GetContext(ctx, key)
+		if errors.Is(err, ErrNotFound) {
+			w.Header().Set(notFoundHeader, "1")
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if expire := view.Expire(); !expire.IsZero() {
+			w.Header().Set(expireHeader, strconv.FormatInt(expire.UnixNano(), 10))
+			w.Header().Set("Expires", expire.UTC().Format(http.TimeFormat))
+		}
+		p.writeView(w, r, view)
+	case http.MethodPut:
+		// the sender routed the key here, so store it without re-picking
+		expire, err := parseExpireHeader(r.Header)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		group.setLocally(key, body, expire)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		group.removeLocally(key)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPost:
+		// POST /<basepath>/<groupname>/ loads a batch of keys
+		if key != "" {
+			http.Error(w, "batch requests take no key in the path", http.StatusBadRequest)
+			return
+		}
+		group.stats.ServerRequests.Add(1)
+		p.serveGetMany(w, r.WithContext(ctx), group)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveHealth tells peers checking on this one that it is up.
+func (p *HTTPPool) serveHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, "ok\n")
+}
+
+// serveGetMany answers a pb.GetManyRequest sent as protobuf or JSON, in the
+// same encoding unless the Accept header asks otherwise.
+func (p *HTTPPool) serveGetMany(w http.ResponseWriter, r *http.Request, group *Group) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &pb.GetManyRequest{}
+	// parameters such as charset don't change the encoding
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	isJSON := mediaType == contentTypeJSON
+	if isJSON {
+		err = protojson.Unmarshal(body, req)
+	} else {
+		err = proto.Unmarshal(body, req)
+	}
+	if err != nil {
+		http.Error(w, "decoding request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res := getManyResponse(group.GetMany(r.Context(), req.GetKeys()))
+	if accept := r.Header.Get("Accept"); accept != "" {
+		isJSON = negotiate(accept) == contentTypeJSON
+	}
+	contentType := contentTypeProtobuf
+	if isJSON {
+		contentType = contentTypeJSON
+		body, err = protojson.Marshal(res)
+	} else {
+		body, err = proto.Marshal(res)
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+// writeView encodes view in the representation the client accepts: a
+// pb.GetResponse for peers, JSON for browsers and raw bytes otherwise.
+func (p *HTTPPool) writeView(w http.ResponseWriter, r *http.Request, view ByteView) {
+	w.Header().Add("Vary", "Accept")
+	contentType := negotiate(r.Header.Get("Accept"))
+	var body []byte
+	switch contentType {
+	case contentTypeProtobuf, contentTypeJSON:
+		res := &pb.GetResponse{Value: view.ByteSlice(), Expire: unixNano(view.Expire())}
+		var err error
+		if contentType == contentTypeProtobuf {
+			body, err = proto.Marshal(res)
+		} else {
+			body, err = protojson.Marshal(res)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		body = view.ByteSlice()
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+// negotiate picks the response content type for an Accept header,
+// honoring q-values and falling back to raw bytes.
+func negotiate(accept string) string {
+	best, bestQ := contentTypeBytes, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case contentTypeProtobuf, contentTypeJSON, contentTypeBytes:
+			if q > bestQ {
+				best, bestQ = mediaType, q
+			}
+		}
+	}
+	return best
+}
 
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Write(view.ByteSlice())
+func parseExpireHeader(h http.Header) (time.Time, error) {
+	v := h.Get(expireHeader)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad %s header: %v", expireHeader, err)
+	}
+	return fromUnixNano(n), nil
 }
 
 type httpGetter struct {
-	baseURL string
+	baseURL   string
+	healthURL string
+	// inflight counts the requests to the peer awaiting a response
+	inflight atomic.Int64
+	// breaker turns requests away while the peer is failing; stateChanged,
+	// if set, is told when its circuit opens or closes
+	breaker      *circuitBreaker
+	stateChanged func(h *httpGetter, open bool)
+	client       *http.Client
+}
+
+func (h *httpGetter) String() string {
+	return h.baseURL
 }
 
 func (h *httpGetter) Get(in *pb.GetRequest, out *pb.GetResponse) error {
-	u := fmt.Sprintf("%v%v/%v", h.baseURL, url.QueryEscape(in.GetGroup()), url.QueryEscape(in.GetKey()))
-	resp, err := http.Get(u)
+	return h.GetContext(context.Background(), in, out)
+}
+
+// GetContext fetches the value from the peer, cancelling the HTTP request
+// when ctx is done.
+func (h *httpGetter) GetContext(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	req, err := h.newRequest(ctx, http.MethodGet, in.GetGroup(), in.GetKey(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", contentTypeProtobuf)
+	resp, err := h.do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound && resp.Header.Get(notFoundHeader) != "" {
+		io.Copy(io.Discard, resp.Body)
+		out.Value, out.Expire, out.NotFound = nil, 0, true
+		return nil
+	}
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("server returned: %v", resp.Status)
 	}
@@ -96,35 +500,388 @@ func (h *httpGetter) Get(in *pb.GetRequest, out *pb.GetResponse) error {
 		return fmt.Errorf("reading response body: %v", err)
 	}
 
+	if resp.Header.Get("Content-Type") == contentTypeBytes {
+		// the peer ignored our Accept header and sent the raw value
+		expire, err := parseExpireHeader(resp.Header)
+		if err != nil {
+			return err
+		}
+		out.Value, out.Expire = bytes, unixNano(expire)
+		return nil
+	}
 	if err = proto.Unmarshal(bytes, out); err != nil {
 		return fmt.Errorf("decoding response body: %v", err)
 	}
 	return nil
 }
 
-var _ PeerGetter = (*httpGetter)(nil)
+// Set stores the value on the peer with a PUT request.
+func (h *httpGetter) Set(ctx context.Context, in *pb.SetRequest, out *pb.SetResponse) error {
+	req, err := h.newRequest(ctx, http.MethodPut, in.GetGroup(), in.GetKey(), bytes.NewReader(in.GetValue()))
+	if err != nil {
+		return err
+	}
+	if in.GetExpire() != 0 {
+		req.Header.Set(expireHeader, strconv.FormatInt(in.GetExpire(), 10))
+	}
+	return h.send(req)
+}
+
+// Remove evicts the key on the peer with a DELETE request.
+func (h *httpGetter) Remove(ctx context.Context, in *pb.RemoveRequest, out *pb.RemoveResponse) error {
+	req, err := h.newRequest(ctx, http.MethodDelete, in.GetGroup(), in.GetKey(), nil)
+	if err != nil {
+		return err
+	}
+	return h.send(req)
+}
+
+// GetMany loads a batch of keys from the peer with one POST request.
+func (h *httpGetter) GetMany(ctx context.Context, in *pb.GetManyRequest, out *pb.GetManyResponse) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := h.newRequest(ctx, http.MethodPost, in.GetGroup(), "", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentTypeProtobuf)
+	req.Header.Set("Accept", contentTypeProtobuf)
+	resp, err := h.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned: %v", resp.Status)
+	}
+	if body, err = io.ReadAll(resp.Body); err != nil {
+		return fmt.Errorf("reading response body: %v", err)
+	}
+	if err = proto.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("decoding response body: %v", err)
+	}
+	return nil
+}
+
+func (h *httpGetter) newRequest(ctx context.Context, method, group, key string, body io.Reader) (*http.Request, error) {
+	u := fmt.Sprintf("%v%v/%v", h.baseURL, url.QueryEscape(group), url.QueryEscape(key))
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(forwardedHeader, "1")
+	return req, nil
+}
+
+// do sends req, counting it as in flight until its response arrives,
+// unless the peer's circuit is open.
+func (h *httpGetter) do(req *http.Request) (*http.Response, error) {
+	if !h.breaker.allow() {
+		return nil, ErrCircuitOpen
+	}
+	h.inflight.Add(1)
+	defer h.inflight.Add(-1)
+	resp, err := h.httpClient().Do(req)
+	switch {
+	case err != nil && req.Context().Err() != nil:
+		h.breaker.abandon()
+	// a 500 may come from the origin the peer asked, not the peer
+	case err != nil || resp.StatusCode == http.StatusBadGateway ||
+		resp.StatusCode == http.StatusServiceUnavailable ||
+		resp.StatusCode == http.StatusGatewayTimeout:
+		h.failed()
+	default:
+		h.succeeded()
+	}
+	return resp, err
+}
+
+// probe checks the peer's health endpoint, which goes out even while its
+// circuit is open, and records the outcome like that of a request.
+func (h *httpGetter) probe(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.healthURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := h.httpClient().Do(req)
+	if err == nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("server returned: %v", resp.Status)
+		}
+	}
+	if err != nil {
+		h.failed()
+		return err
+	}
+	h.succeeded()
+	return nil
+}
+
+func (h *httpGetter) httpClient() *http.Client {
+	if h.client != nil {
+		return h.client
+	}
+	return http.DefaultClient
+}
+
+func (h *httpGetter) failed() {
+	if h.breaker.failure() && h.stateChanged != nil {
+		h.stateChanged(h, true)
+	}
+}
+
+func (h *httpGetter) succeeded() {
+	if h.breaker.success() && h.stateChanged != nil {
+		h.stateChanged(h, false)
+	}
+}
+
+// send performs a request whose response carries no body of interest.
+func (h *httpGetter) send(req *http.Request) error {
+	resp, err := h.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("server returned: %v", resp.Status)
+	}
+	return nil
+}
+
+var (
+	_ PeerGetter        = (*httpGetter)(nil)
+	_ ContextPeerGetter = (*httpGetter)(nil)
+	_ PeerUpdater       = (*httpGetter)(nil)
+	_ PeerBatchGetter   = (*httpGetter)(nil)
+)
 
-// Set updates the pool's list of peers.
+// Set updates the pool's list of peers, all with weight 1. Getters of
+// peers that stay in the pool are kept, and only keys of added or removed
+// peers move.
 func (p *HTTPPool) Set(peers ...string) {
+	weights := make(map[string]int, len(peers))
+	for _, peer := range peers {
+		weights[peer] = 1
+	}
+	p.SetWeighted(weights)
+}
+
+// SetWeighted is like Set, but each peer receives a share of the keys
+// proportional to its weight, e.g. its cache size. Peers with a weight of
+// 0 or less are left out.
+func (p *HTTPPool) SetWeighted(weights map[string]int) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.peers = consistenthash.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
-	p.httpGetters = make(map[string]*httpGetter, len(peers))
-	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+	p.update(func(w map[string]int) {
+		clear(w)
+		for peer, weight := range weights {
+			if weight > 0 {
+				w[peer] = weight
+			}
+		}
+	})
+}
+
+// Add adds peers to the pool with weight 1. Peers already in the pool keep
+// their weight.
+func (p *HTTPPool) Add(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.update(func(w map[string]int) {
+		for _, peer := range peers {
+			if _, ok := w[peer]; !ok {
+				w[peer] = 1
+			}
+		}
+	})
+}
+
+// Remove removes peers from the pool.
+func (p *HTTPPool) Remove(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.update(func(w map[string]int) {
+		for _, peer := range peers {
+			delete(w, peer)
+		}
+	})
+}
+
+// update applies fn to the peer weights and hands them to the placement.
+// Getters of new peers are published before the placement picks them, and
+// getters of removed peers are dropped after it stops picking them.
+// Getters of peers that stay are kept.
+func (p *HTTPPool) update(fn func(weights map[string]int)) {
+	fn(p.weights)
+	old := p.getters()
+	getters := make(map[string]*httpGetter, len(old)+len(p.weights))
+	for peer, g := range old {
+		getters[peer] = g
 	}
+	for peer := range p.weights {
+		if _, ok := getters[peer]; !ok {
+			getters[peer] = p.newGetter(peer)
+		}
+	}
+	p.httpGetters.Store(&getters)
+	p.setPlacement()
+
+	if len(getters) == len(p.weights) {
+		return
+	}
+	kept := make(map[string]*httpGetter, len(p.weights))
+	for peer := range p.weights {
+		kept[peer] = getters[peer]
+	}
+	p.httpGetters.Store(&kept)
 }
 
-// PickPeer picks a peer according to key
-func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
+func (p *HTTPPool) newGetter(peer string) *httpGetter {
+	g := &httpGetter{baseURL: peer + p.basePath, healthURL: peer + healthPath, client: p.client}
+	if p.breakAfter > 0 {
+		g.breaker = newCircuitBreaker(p.breakAfter, p.breakFor)
+		g.stateChanged = p.peerStateChanged
+	}
+	return g
+}
+
+// setPlacement hands the weights of the peers whose circuit is not open to
+// the placement, if they changed.
+func (p *HTTPPool) setPlacement() {
+	getters := p.getters()
+	available := make(map[string]int, len(p.weights))
+	for peer, weight := range p.weights {
+		if g, ok := getters[peer]; ok && g.breaker.open() {
+			continue
+		}
+		available[peer] = weight
+	}
+	if maps.Equal(available, p.available) && p.available != nil {
+		return
+	}
+	p.available = available
+	p.peers.Set(available)
+}
+
+// refreshPlacement updates the placement after a peer's circuit changed.
+func (p *HTTPPool) refreshPlacement() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	p.setPlacement()
+}
+
+// peerStateChanged takes a peer whose circuit opened out of the placement,
+// and puts it back when the cooldown ends, to receive the request that
+// tests it, or as soon as its circuit closes.
+func (p *HTTPPool) peerStateChanged(g *httpGetter, open bool) {
+	if open {
+		p.Log("Peer %s is failing, removing it for %v", g, p.breakFor)
+		time.AfterFunc(p.breakFor, p.refreshPlacement)
+	} else {
+		p.Log("Peer %s recovered", g)
+	}
+	p.refreshPlacement()
+}
+
+// getters returns the current getters, which must not be modified.
+func (p *HTTPPool) getters() map[string]*httpGetter {
+	if g := p.httpGetters.Load(); g != nil {
+		return *g
+	}
+	return nil
+}
+
+// PickPeer picks a peer according to key
+func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
+	if peer := p.pick(key); peer != "" && peer != p.self {
+		if g, ok := p.getters()[peer]; ok {
+			p.Log("Pick peer %s", peer)
+			return g, true
+		}
+	}
+	return nil, false
+}
+
+// PickOwner picks the peer that owns key by placement alone, ignoring
+// loads, for writes.
+func (p *HTTPPool) PickOwner(key string) (PeerGetter, bool) {
 	if peer := p.peers.Get(key); peer != "" && peer != p.self {
-		p.Log("Pick peer %s", peer)
-		return p.httpGetters[peer], true
+		if g, ok := p.getters()[peer]; ok {
+			return g, true
+		}
 	}
 	return nil, false
 }
 
-var _ PeerPicker = (*HTTPPool)(nil)
+// PickPeers returns the replicas of key in order, up to the pool's read
+// replicas, stopping at this peer. With bounded loads the first is the
+// peer PickPeer would pick, followed by the other replicas.
+func (p *HTTPPool) PickPeers(key string) []PeerGetter {
+	r, ok := p.peers.(placement.Replicas)
+	if !ok || p.readReplicas <= 1 {
+		if peer, ok := p.PickPeer(key); ok {
+			return []PeerGetter{peer}
+		}
+		return nil
+	}
+	first := p.pick(key)
+	nodes := []string{first}
+	for _, node := range r.GetN(key, p.readReplicas) {
+		if node != first && len(nodes) < p.readReplicas {
+			nodes = append(nodes, node)
+		}
+	}
+	var peers []PeerGetter
+	getters := p.getters()
+	for _, node := range nodes {
+		if node == p.self {
+			break
+		}
+		if g, ok := getters[node]; ok {
+			peers = append(peers, g)
+		}
+	}
+	return peers
+}
+
+func (p *HTTPPool) pick(key string) string {
+	if p.loadFactor > 0 {
+		if bl, ok := p.peers.(placement.BoundedLoad); ok {
+			return bl.GetWithLoad(key, p.loadFactor, p.load)
+		}
+	}
+	return p.peers.Get(key)
+}
+
+// startLoad counts a load from a group's getter until done is called.
+func (p *HTTPPool) startLoad() (done func()) {
+	p.serving.Add(1)
+	return func() { p.serving.Add(-1) }
+}
+
+// load returns the requests in flight to peer, or being served if peer is
+// this one.
+func (p *HTTPPool) load(peer string) int64 {
+	if peer == p.self {
+		return p.serving.Load()
+	}
+	if g, ok := p.getters()[peer]; ok {
+		return g.inflight.Load()
+	}
+	return 0
+}
+
+var (
+	_ PeerPicker    = (*HTTPPool)(nil)
+	_ ReplicaPicker = (*HTTPPool)(nil)
+	_ OwnerPicker   = (*HTTPPool)(nil)
+	_ loadCounter   = (*HTTPPool)(nil)
+)
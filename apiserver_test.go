@@ -1,14 +1,24 @@
 package distributed_cache
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"distributed-cache/consistenthash"
 	pb "distributed-cache/gen/v1"
+	"distributed-cache/placement"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -83,14 +93,14 @@ func TestHTTPPool_Set(t *testing.T) {
 	pool.Set(peers...)
 
 	// 验证是否正确设置了 httpGetters
-	if len(pool.httpGetters) != len(peers) {
+	if len(pool.getters()) != len(peers) {
 		t.Errorf("wrong number of peers: got %v, want %v",
-			len(pool.httpGetters), len(peers))
+			len(pool.getters()), len(peers))
 	}
 
 	// 验证每个节点的 baseURL 是否正确
 	for _, peer := range peers {
-		if getter, ok := pool.httpGetters[peer]; !ok {
+		if getter, ok := pool.getters()[peer]; !ok {
 			t.Errorf("missing getter for peer %s", peer)
 		} else {
 			expectedURL := peer + defaultBasePath
@@ -102,6 +112,199 @@ func TestHTTPPool_Set(t *testing.T) {
 	}
 }
 
+func TestHTTPPool_AddRemove(t *testing.T) {
+	pool := NewHTTPPool("http://localhost:8001")
+	pool.Set("http://localhost:8001", "http://localhost:8002")
+	kept := pool.getters()["http://localhost:8002"]
+
+	// 增删节点时复用未变化节点的 getter
+	pool.Add("http://localhost:8003")
+	pool.Remove("http://localhost:8001")
+	if got := len(pool.getters()); got != 2 {
+		t.Fatalf("wrong number of peers: got %v, want 2", got)
+	}
+	if pool.getters()["http://localhost:8002"] != kept {
+		t.Fatalf("getter of unchanged peer should be reused")
+	}
+	pool.Set("http://localhost:8002", "http://localhost:8004")
+	if pool.getters()["http://localhost:8002"] != kept {
+		t.Fatalf("Set should reuse the getter of an unchanged peer")
+	}
+	if _, ok := pool.getters()["http://localhost:8003"]; ok {
+		t.Fatalf("Set should drop peers not in the list")
+	}
+
+	for i := 0; i < 100; i++ {
+		peer, ok := pool.PickPeer(fmt.Sprintf("key-%d", i))
+		if !ok {
+			t.Fatalf("self is no longer in the ring, every key should go to a peer")
+		}
+		if url := peer.(*httpGetter).baseURL; url != "http://localhost:8002"+defaultBasePath && url != "http://localhost:8004"+defaultBasePath {
+			t.Fatalf("picked removed peer %s", url)
+		}
+	}
+}
+
+func TestHTTPPool_SetWeighted(t *testing.T) {
+	pool := NewHTTPPool("http://localhost:8001")
+	pool.SetWeighted(map[string]int{
+		"http://localhost:8001": 1,
+		"http://localhost:8002": 4,
+		"http://localhost:8003": 0,
+	})
+	if got := len(pool.getters()); got != 2 {
+		t.Fatalf("wrong number of peers: got %v, want 2", got)
+	}
+	if got := pool.weights["http://localhost:8002"]; got != 4 {
+		t.Fatalf("weight of peer = %d, want 4", got)
+	}
+
+	// 权重更大的节点分到更多的 key
+	remote := 0
+	for i := 0; i < 1000; i++ {
+		if _, ok := pool.PickPeer(fmt.Sprintf("key-%d", i)); ok {
+			remote++
+		}
+	}
+	if remote < 600 {
+		t.Fatalf("peer with weight 4 got %d of 1000 keys", remote)
+	}
+
+	// Set 恢复默认权重
+	pool.Set("http://localhost:8001", "http://localhost:8002")
+	if got := pool.weights["http://localhost:8002"]; got != 1 {
+		t.Fatalf("weight after Set = %d, want 1", got)
+	}
+}
+
+func TestHTTPPool_Placement(t *testing.T) {
+	peers := []string{"http://localhost:8001", "http://localhost:8002", "http://localhost:8003"}
+	for _, pl := range []placement.Placement{placement.NewJump(), placement.NewRendezvous(), placement.NewMaglev(0)} {
+		pool := NewHTTPPoolWithPlacement("http://localhost:8001", pl)
+		pool.Set(peers...)
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprintf("key-%d", i)
+			peer, ok := pool.PickPeer(key)
+			// 选中的节点与放置算法的结果一致
+			if owner := pl.Get(key); ok != (owner != "http://localhost:8001") ||
+				ok && peer.(*httpGetter).baseURL != owner+defaultBasePath {
+				t.Fatalf("%T: PickPeer(%s) disagrees with owner %s", pl, key, owner)
+			}
+		}
+	}
+}
+
+func TestHTTPPool_BoundedLoad(t *testing.T) {
+	pool := NewHTTPPool("http://localhost:8001")
+	pool.SetLoadFactor(1.25)
+	pool.SetReadReplicas(2)
+	pool.Set("http://localhost:8001", "http://localhost:8002", "http://localhost:8003")
+
+	key := ""
+	var owner *httpGetter
+	for i := 0; owner == nil; i++ {
+		key = fmt.Sprintf("key-%d", i)
+		if peer, ok := pool.PickPeer(key); ok {
+			owner = peer.(*httpGetter)
+		}
+	}
+
+	// 节点正在处理的请求过多时，key 交给环上的下一个节点
+	owner.inflight.Add(10)
+	picked, ok := pool.PickPeer(key)
+	if ok && picked == owner {
+		t.Fatalf("overloaded peer should be passed over")
+	}
+	// 读副本时第一个也按负载选取
+	if peers := pool.PickPeers(key); ok != (len(peers) > 0) || ok && peers[0] != picked {
+		t.Fatalf("PickPeers(%s) = %v, want %v first", key, peers, picked)
+	}
+	// 写入仍然发给真正的所有者
+	if peer, ok := pool.PickOwner(key); !ok || peer != owner {
+		t.Fatalf("PickOwner(%s) = %v, want the owner regardless of load", key, peer)
+	}
+	owner.inflight.Add(-10)
+	if peer, _ := pool.PickPeer(key); peer != owner {
+		t.Fatalf("key should go back to its owner once load drops")
+	}
+}
+
+func TestHTTPPool_SelfLoad(t *testing.T) {
+	self := "http://localhost:8001"
+	pool := NewHTTPPool(self)
+	pool.SetLoadFactor(1.25)
+	var remoteLoad atomic.Int64
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteLoad.Store(pool.load(self))
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer remote.Close()
+	pool.Set(self, remote.URL)
+
+	var localLoad atomic.Int64
+	group := NewGroup("http-self-load", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			localLoad.Store(pool.load(self))
+			return []byte("630"), nil
+		}), WithHotCacheBytes(0), WithPeerFailurePolicy(PeerFailurePolicy{FailFast: true}))
+	group.RegisterPeers(pool)
+
+	// 本节点从数据源加载时计入自身负载
+	if _, err := group.Get(keyOwnedBy(t, pool, self)); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got := localLoad.Load(); got != 1 {
+		t.Fatalf("load during a local load = %d, want 1", got)
+	}
+
+	// 等待其他节点的客户端请求不计入自身负载
+	key := keyOwnedBy(t, pool, remote.URL)
+	req := httptest.NewRequest(http.MethodGet, defaultBasePath+"http-self-load/"+key, nil)
+	pool.ServeHTTP(httptest.NewRecorder(), req)
+	if got := remoteLoad.Load(); got != 0 {
+		t.Fatalf("load while waiting on a peer = %d, want 0", got)
+	}
+
+	// 其他节点转发来的请求只计一次
+	req = httptest.NewRequest(http.MethodGet, defaultBasePath+"http-self-load/"+key, nil)
+	req.Header.Set(forwardedHeader, "1")
+	pool.ServeHTTP(httptest.NewRecorder(), req)
+	if got := localLoad.Load(); got != 1 {
+		t.Fatalf("load during a forwarded request = %d, want 1", got)
+	}
+	if got := pool.load(self); got != 0 {
+		t.Fatalf("load after the requests = %d, want 0", got)
+	}
+}
+
+func TestHTTPPool_PickPeers(t *testing.T) {
+	self := "http://localhost:8001"
+	pool := NewHTTPPool(self)
+	pool.SetReadReplicas(2)
+	pool.Set(self, "http://localhost:8002", "http://localhost:8003")
+	ring := pool.peers.(placement.Replicas)
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		replicas := ring.GetN(key, 2)
+		peers := pool.PickPeers(key)
+		// 副本按顺序返回，遇到自身时停止
+		want := 0
+		for _, node := range replicas {
+			if node == self {
+				break
+			}
+			if peers[want].(*httpGetter).baseURL != node+defaultBasePath {
+				t.Fatalf("PickPeers(%s)[%d] = %s, want %s", key, want, peers[want].(*httpGetter).baseURL, node)
+			}
+			want++
+		}
+		if len(peers) != want {
+			t.Fatalf("PickPeers(%s) returned %d peers, want %d", key, len(peers), want)
+		}
+	}
+}
+
 func TestHTTPGetter_Get(t *testing.T) {
 	// 创建一个测试服务器
 	handler := func(w http.ResponseWriter, r *http.Request) {
@@ -111,6 +314,7 @@ func TestHTTPGetter_Get(t *testing.T) {
 				Value: []byte("630"),
 			}
 			bytes, _ := proto.Marshal(response)
+			w.Header().Set("Content-Type", "application/x-protobuf")
 			w.Write(bytes)
 			return
 		}
@@ -153,6 +357,9 @@ func TestHTTPGetter_Get(t *testing.T) {
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Get() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if !tt.wantErr && string(response.GetValue()) != "630" {
+				t.Errorf("Get() value = %q, want 630", response.GetValue())
+			}
 		})
 	}
 }
@@ -176,6 +383,16 @@ func TestHTTPPool_ConcurrentAccess(t *testing.T) {
 			_, _ = pool.PickPeer(key)
 		}(i)
 	}
+	// 选择节点的同时更新节点列表
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			peer := fmt.Sprintf("http://localhost:%d", 9000+i)
+			pool.Add(peer)
+			pool.Remove(peer)
+		}(i)
+	}
 
 	done := make(chan struct{})
 	go func() {
@@ -190,3 +407,510 @@ func TestHTTPPool_ConcurrentAccess(t *testing.T) {
 		t.Error("timeout waiting for concurrent access")
 	}
 }
+
+func TestHTTPGetter_GetContextCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	getter := &httpGetter{baseURL: server.URL + "/cache/"}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var response pb.GetResponse
+	err := getter.GetContext(ctx, &pb.GetRequest{Group: "scores", Key: "Tom"}, &response)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestHTTPPool_SetRemove(t *testing.T) {
+	g := NewGroup("remote-writes", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("origin"), nil
+		}))
+
+	pool := NewHTTPPool("http://example.com")
+	server := httptest.NewServer(pool)
+	defer server.Close()
+
+	getter := &httpGetter{baseURL: server.URL + defaultBasePath}
+	ctx := context.Background()
+
+	err := getter.Set(ctx, &pb.SetRequest{Group: "remote-writes", Key: "Tom", Value: []byte("700")}, &pb.SetResponse{})
+	if err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if view, ok := g.mainCache.get("Tom"); !ok || view.String() != "700" {
+		t.Fatalf("PUT did not store value on owner, got %q", view.String())
+	}
+
+	// 过期时间随写入一起传播
+	expire := time.Now().Add(time.Hour)
+	err = getter.Set(ctx, &pb.SetRequest{Group: "remote-writes", Key: "Jack", Value: []byte("589"), Expire: expire.UnixNano()}, &pb.SetResponse{})
+	if err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if view, ok := g.mainCache.get("Jack"); !ok || view.Expire().UnixNano() != expire.UnixNano() {
+		t.Fatalf("PUT did not store expiry on owner, got %v", view.Expire())
+	}
+	resp, err := http.Get(server.URL + "/cache/remote-writes/Jack")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get(expireHeader); got != strconv.FormatInt(expire.UnixNano(), 10) {
+		t.Fatalf("%s header = %q, want %d", expireHeader, got, expire.UnixNano())
+	}
+
+	err = getter.Remove(ctx, &pb.RemoveRequest{Group: "remote-writes", Key: "Tom"}, &pb.RemoveResponse{})
+	if err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, ok := g.mainCache.get("Tom"); ok {
+		t.Fatalf("DELETE did not evict value on owner")
+	}
+
+	req, _ := http.NewRequest(http.MethodPatch, server.URL+"/cache/remote-writes/Tom", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("got status %v, want %v", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHTTPPool_ContentNegotiation(t *testing.T) {
+	expire := time.Now().Add(time.Hour)
+	NewGroup("negotiation", 2<<10, ExpireGetterFunc(
+		func(ctx context.Context, key string) ([]byte, time.Time, error) {
+			return []byte("630"), expire, nil
+		}))
+
+	pool := NewHTTPPool("http://example.com")
+	server := httptest.NewServer(pool)
+	defer server.Close()
+
+	tests := []struct {
+		name            string
+		accept          string
+		wantContentType string
+	}{
+		{name: "default", accept: "", wantContentType: "application/octet-stream"},
+		{name: "any", accept: "*/*", wantContentType: "application/octet-stream"},
+		{name: "protobuf", accept: "application/x-protobuf", wantContentType: "application/x-protobuf"},
+		{name: "json", accept: "text/html, application/json;q=0.9", wantContentType: "application/json"},
+		{name: "q-values", accept: "application/json;q=0.5, application/x-protobuf", wantContentType: "application/x-protobuf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, server.URL+"/cache/negotiation/Tom", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if got := resp.Header.Get("Content-Type"); got != tt.wantContentType {
+				t.Fatalf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			var out pb.GetResponse
+			switch tt.wantContentType {
+			case "application/x-protobuf":
+				if err := proto.Unmarshal(body, &out); err != nil {
+					t.Fatalf("decoding protobuf body: %v", err)
+				}
+			case "application/json":
+				if err := protojson.Unmarshal(body, &out); err != nil {
+					t.Fatalf("decoding json body: %v", err)
+				}
+			default:
+				out.Value = body
+				out.Expire = expire.UnixNano()
+			}
+			if string(out.GetValue()) != "630" || out.GetExpire() != expire.UnixNano() {
+				t.Fatalf("got value %q expire %d, want 630 expire %d", out.GetValue(), out.GetExpire(), expire.UnixNano())
+			}
+		})
+	}
+
+	// 节点之间使用 protobuf 通信
+	getter := &httpGetter{baseURL: server.URL + defaultBasePath}
+	var out pb.GetResponse
+	if err := getter.Get(&pb.GetRequest{Group: "negotiation", Key: "Tom"}, &out); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if string(out.GetValue()) != "630" || out.GetExpire() != expire.UnixNano() {
+		t.Fatalf("peer got value %q expire %d", out.GetValue(), out.GetExpire())
+	}
+}
+
+func TestHTTPPool_GetMany(t *testing.T) {
+	NewGroup("http-batch", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+
+	pool := NewHTTPPool("http://example.com")
+	server := httptest.NewServer(pool)
+	defer server.Close()
+
+	getter := &httpGetter{baseURL: server.URL + defaultBasePath}
+	var out pb.GetManyResponse
+	err := getter.GetMany(context.Background(), &pb.GetManyRequest{Group: "http-batch", Keys: []string{"Tom", "unknown", "Jack"}}, &out)
+	if err != nil {
+		t.Fatalf("GetMany() error = %v", err)
+	}
+	results := out.GetResults()
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if results[0].GetKey() != "Tom" || string(results[0].GetValue()) != "630" {
+		t.Errorf("result 0 = %v", results[0])
+	}
+	if results[1].GetKey() != "unknown" || results[1].GetError() == "" {
+		t.Errorf("result 1 should carry an error, got %v", results[1])
+	}
+	if results[2].GetKey() != "Jack" || string(results[2].GetValue()) != "589" {
+		t.Errorf("result 2 = %v", results[2])
+	}
+
+	// JSON 请求体的 Content-Type 可以带 charset 等参数，响应也用 JSON
+	resp, err := http.Post(server.URL+"/cache/http-batch/", "application/json; charset=utf-8",
+		strings.NewReader(`{"group": "http-batch", "keys": ["Tom"]}`))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	var jsonOut pb.GetManyResponse
+	if resp.StatusCode != http.StatusOK || protojson.Unmarshal(body, &jsonOut) != nil {
+		t.Fatalf("JSON batch got status %v, body %q", resp.StatusCode, body)
+	}
+	if r := jsonOut.GetResults(); len(r) != 1 || string(r[0].GetValue()) != "630" {
+		t.Errorf("JSON batch results = %v", r)
+	}
+
+	// 批量请求的路径中不能带 key
+	resp, err = http.Post(server.URL+"/cache/http-batch/Tom", "application/x-protobuf", nil)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %v, want %v", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestHTTPPool_NotFound(t *testing.T) {
+	NewGroup("http-not-found", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, ErrNotFound
+		}))
+
+	pool := NewHTTPPool("http://example.com")
+	server := httptest.NewServer(pool)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/cache/http-not-found/unknown")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound || resp.Header.Get(notFoundHeader) == "" {
+		t.Fatalf("got status %v with %s %q, want 404", resp.StatusCode, notFoundHeader, resp.Header.Get(notFoundHeader))
+	}
+
+	getter := &httpGetter{baseURL: server.URL + defaultBasePath}
+	var out pb.GetResponse
+	if err := getter.Get(&pb.GetRequest{Group: "http-not-found", Key: "unknown"}, &out); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if !out.GetNotFound() {
+		t.Fatalf("expect not_found in response")
+	}
+
+	// 未知分组的 404 仍然是错误
+	if err := getter.Get(&pb.GetRequest{Group: "invalid-group", Key: "Tom"}, &pb.GetResponse{}); err == nil {
+		t.Fatalf("expect error for unknown group")
+	}
+
+	var many pb.GetManyResponse
+	err = getter.GetMany(context.Background(), &pb.GetManyRequest{Group: "http-not-found", Keys: []string{"Tom", "unknown"}}, &many)
+	if err != nil {
+		t.Fatalf("GetMany() error = %v", err)
+	}
+	if r := many.GetResults(); len(r) != 2 || r[0].GetNotFound() || !r[1].GetNotFound() || r[1].GetError() != "" {
+		t.Fatalf("unexpected results %v", r)
+	}
+}
+
+func TestHTTPPool_Health(t *testing.T) {
+	server := httptest.NewServer(NewHTTPPool("http://example.com"))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + healthPath)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("health check returned %v", resp.Status)
+	}
+}
+
+// keyOwnedBy returns a key that pool places on peer.
+func keyOwnedBy(t *testing.T, pool *HTTPPool, peer string) string {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if pool.peers.Get(key) == peer {
+			return key
+		}
+	}
+	t.Fatalf("no key owned by %s", peer)
+	return ""
+}
+
+func TestHTTPPool_CircuitBreaker(t *testing.T) {
+	self := "http://localhost:8001"
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	// 断路器默认关闭
+	plain := NewHTTPPool(self)
+	plain.Set(self, down.URL)
+	if plain.getters()[down.URL].breaker != nil {
+		t.Fatal("circuit breaker must be off by default")
+	}
+
+	pool := NewHTTPPool(self)
+	pool.SetCircuitBreaker(2, 50*time.Millisecond)
+	pool.Set(self, down.URL)
+	key := keyOwnedBy(t, pool, down.URL)
+	getter := pool.getters()[down.URL]
+
+	// 连续失败两次后断开，节点暂时从环上移除
+	for i := 0; i < 2; i++ {
+		if err := getter.Get(&pb.GetRequest{Group: "scores", Key: key}, &pb.GetResponse{}); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("request %d: got %v, want a connection error", i, err)
+		}
+	}
+	if err := getter.Get(&pb.GetRequest{Group: "scores", Key: key}, &pb.GetResponse{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v, want ErrCircuitOpen", err)
+	}
+	if _, ok := pool.PickPeer(key); ok {
+		t.Fatalf("PickPeer(%s) picked a peer whose circuit is open", key)
+	}
+
+	// 冷却结束后节点回到环上，接受一次试探请求
+	deadline := time.Now().Add(time.Second)
+	for {
+		if peer, ok := pool.PickPeer(key); ok {
+			if peer != getter {
+				t.Fatalf("PickPeer(%s) = %v, want %s", key, peer, down.URL)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("peer did not return to the ring after the cooldown")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHTTPPool_HealthChecks(t *testing.T) {
+	var unhealthy atomic.Bool
+	peerPool := NewHTTPPool("")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unhealthy.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		peerPool.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	self := "http://localhost:8001"
+	pool := NewHTTPPool(self)
+	pool.SetCircuitBreaker(1, time.Hour)
+	pool.Set(self, server.URL)
+	key := keyOwnedBy(t, pool, server.URL)
+	pool.StartHealthChecks(10 * time.Millisecond)
+	defer pool.StopHealthChecks()
+
+	waitFor := func(picked bool) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for {
+			if _, ok := pool.PickPeer(key); ok == picked {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("PickPeer(%s) did not return ok = %v", key, picked)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	// 健康检查失败后移除节点，恢复后不必等冷却结束即可重新加入
+	unhealthy.Store(true)
+	waitFor(false)
+	unhealthy.Store(false)
+	waitFor(true)
+}
+
+// countingTransport 统计经过的请求
+type countingTransport struct {
+	requests atomic.Int64
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNewHTTPPoolOpts(t *testing.T) {
+	NewGroup("http-opts", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "slow" {
+				time.Sleep(200 * time.Millisecond)
+			}
+			return []byte(db[key]), nil
+		}))
+
+	var hashes atomic.Int64
+	transport := &countingTransport{}
+	opts := &HTTPPoolOptions{
+		BasePath: "api",
+		Replicas: 7,
+		HashFn: func(data []byte) uint32 {
+			hashes.Add(1)
+			return crc32.ChecksumIEEE(data)
+		},
+		Transport: transport,
+		Timeout:   50 * time.Millisecond,
+	}
+	server := httptest.NewServer(NewHTTPPoolOpts("", opts))
+	defer server.Close()
+
+	self := "http://localhost:8001"
+	pool := NewHTTPPoolOpts(self, opts)
+	pool.Set(self, server.URL)
+
+	// 环使用给定的虚拟节点数和哈希函数
+	if stats := pool.peers.(*consistenthash.Map).Stats(); stats.VirtualNodes != 14 || hashes.Load() == 0 {
+		t.Fatalf("ring has %d virtual nodes with %d calls to HashFn, want 14 and some", stats.VirtualNodes, hashes.Load())
+	}
+
+	// 请求走自定义路径和 Transport
+	getter := pool.getters()[server.URL]
+	if getter.baseURL != server.URL+"/api/" {
+		t.Fatalf("base URL = %s, want %s/api/", getter.baseURL, server.URL)
+	}
+	var out pb.GetResponse
+	if err := getter.Get(&pb.GetRequest{Group: "http-opts", Key: "Tom"}, &out); err != nil || string(out.Value) != "630" {
+		t.Fatalf("Get() = %q, %v, want 630", out.Value, err)
+	}
+	if transport.requests.Load() != 1 {
+		t.Fatalf("transport carried %d requests, want 1", transport.requests.Load())
+	}
+
+	// 超时的请求返回错误
+	start := time.Now()
+	if err := getter.Get(&pb.GetRequest{Group: "http-opts", Key: "slow"}, &out); err == nil {
+		t.Fatal("Get() of a slow key succeeded despite the timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Fatalf("Get() returned after %v, want about 50ms", elapsed)
+	}
+
+	// 规范化基础路径，"/" 表示根路径
+	for basePath, want := range map[string]string{"/": "/", "api": "/api/", "/api/v1/": "/api/v1/"} {
+		if got := NewHTTPPoolOpts("", &HTTPPoolOptions{BasePath: basePath}).basePath; got != want {
+			t.Errorf("BasePath %q gives %q, want %q", basePath, got, want)
+		}
+	}
+
+	// 根路径下也能正常处理请求
+	NewGroup("http-root", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	root := httptest.NewServer(NewHTTPPoolOpts("", &HTTPPoolOptions{BasePath: "/"}))
+	defer root.Close()
+	getter = &httpGetter{baseURL: root.URL + "/"}
+	if err := getter.Get(&pb.GetRequest{Group: "http-root", Key: "Tom"}, &out); err != nil || string(out.Value) != "630" {
+		t.Fatalf("Get() = %q, %v, want 630", out.Value, err)
+	}
+}
+
+func TestNewHTTPPoolOpts_MaxIdleConnsPerHost(t *testing.T) {
+	pool := NewHTTPPoolOpts("", &HTTPPoolOptions{MaxIdleConnsPerHost: 32})
+	if pool.basePath != defaultBasePath {
+		t.Fatalf("base path = %s, want %s", pool.basePath, defaultBasePath)
+	}
+	transport, ok := pool.client.Transport.(*http.Transport)
+	if !ok || transport.MaxIdleConnsPerHost != 32 || transport == http.DefaultTransport {
+		t.Fatalf("client transport = %#v, want a copy of the default with 32 idle conns per host", pool.client.Transport)
+	}
+	if NewHTTPPool("").client != nil {
+		t.Fatal("default pool must use http.DefaultClient")
+	}
+}
+
+func TestHTTPPool_Forwarded(t *testing.T) {
+	group := NewGroup("http-forwarded", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("local"), nil
+		}), WithHotCacheBytes(0))
+	peer := &countingPeerGetter{mockPeerGetter: mockPeerGetter{mockData: map[string][]byte{"Tom": []byte("peer")}}}
+	group.RegisterPeers(&mockPeerPicker{peer: peer})
+	server := httptest.NewServer(NewHTTPPool("http://example.com"))
+	defer server.Close()
+
+	// 其他节点转发来的请求由本节点直接处理，不再转发
+	getter := &httpGetter{baseURL: server.URL + defaultBasePath}
+	var out pb.GetResponse
+	if err := getter.Get(&pb.GetRequest{Group: "http-forwarded", Key: "Tom"}, &out); err != nil || string(out.Value) != "local" {
+		t.Fatalf("Get() = %q, %v, want local", out.Value, err)
+	}
+	var many pb.GetManyResponse
+	if err := getter.GetMany(context.Background(), &pb.GetManyRequest{Group: "http-forwarded", Keys: []string{"Jack"}}, &many); err != nil {
+		t.Fatalf("GetMany() error = %v", err)
+	}
+	if r := many.GetResults(); len(r) != 1 || string(r[0].GetValue()) != "local" {
+		t.Fatalf("GetMany() results = %v, want local", r)
+	}
+	if peer.calls != 0 {
+		t.Fatalf("forwarded requests reached a peer %d times", peer.calls)
+	}
+
+	// 客户端的请求照常交给所有者
+	resp, err := http.Get(server.URL + "/cache/http-forwarded/Sam")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	resp.Body.Close()
+	if peer.calls != 1 {
+		t.Fatalf("client request reached a peer %d times, want 1", peer.calls)
+	}
+}
@@ -1,13 +1,27 @@
 package distributed_cache
 
+import "time"
+
 type ByteView struct {
 	b []byte
+	e time.Time
+	// notFound marks a tombstone for a key the getter reported as
+	// ErrNotFound; it holds no bytes, so only its key is charged to the cache.
+	notFound bool
+	// delta is how long the value took to load, for early refresh
+	delta time.Duration
 }
 
 func (v ByteView) Len() int {
 	return len(v.b)
 }
 
+// Expire returns the time after which the view is stale; the zero time
+// means it never expires.
+func (v ByteView) Expire() time.Time {
+	return v.e
+}
+
 func (v ByteView) ByteSlice() []byte {
 	return cloneBytes(v.b)
 }
@@ -21,3 +35,19 @@ func cloneBytes(b []byte) []byte {
 	copy(c, b)
 	return c
 }
+
+// unixNano encodes t for the wire, mapping the zero time to 0.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano is the inverse of unixNano.
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
@@ -13,8 +13,25 @@ type Cache struct {
 	maxBytes int64
 	nBytes   int64
 	eviction strategy.EvictionStrategy
+	janitor  *strategy.Janitor
+
+	// removing tells OnEntryRemoved why the strategy drops an entry
+	removing    removal
+	nItems      int64
+	nGet, nHit  int64
+	nEvict      int64
+	nExpiration int64
 }
 
+type removal int
+
+const (
+	removalReplaced removal = iota
+	removalEvicted
+	removalExpired
+	removalDeleted
+)
+
 func NewCache(maxBytes int64, eviction strategy.EvictionStrategy) *Cache {
 	c := &Cache{
 		maxBytes: maxBytes,
@@ -35,8 +52,11 @@ func (c *Cache) add(key string, value ByteView, expire time.Time) {
 		c.eviction = lru.New()
 		c.eviction.SetRemover(c)
 	}
+	c.removing = removalReplaced
 	c.eviction.Add(key, value, expire)
 	c.nBytes += int64(len(key)) + int64(value.Len())
+	c.nItems++
+	c.removing = removalEvicted
 	for c.nBytes > c.maxBytes {
 		c.eviction.RemoveOldest()
 	}
@@ -49,12 +69,82 @@ func (c *Cache) get(key string) (value ByteView, ok bool) {
 		c.eviction = lru.New()
 		c.eviction.SetRemover(c)
 	}
+	c.nGet++
+	// strategies drop expired entries they come across in Get
+	c.removing = removalExpired
 	if v, ok := c.eviction.Get(key); ok {
+		c.nHit++
 		return v.(ByteView), ok
 	}
 	return
 }
 
+func (c *Cache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.eviction == nil {
+		return
+	}
+	c.removing = removalDeleted
+	c.eviction.Remove(key)
+}
+
+func (c *Cache) removeExpired() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.eviction == nil {
+		return 0
+	}
+	c.removing = removalExpired
+	return c.eviction.RemoveExpired()
+}
+
+// StartJanitor removes expired entries every interval, rather than waiting
+// for them to be read or evicted, until Stop is called.
+func (c *Cache) StartJanitor(interval time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.janitor != nil {
+		return
+	}
+	c.janitor = strategy.StartJanitor(interval, func() {
+		c.removeExpired()
+	})
+}
+
+// Stop stops the janitor started by StartJanitor.
+func (c *Cache) Stop() {
+	c.mu.Lock()
+	j := c.janitor
+	c.janitor = nil
+	c.mu.Unlock()
+	if j != nil {
+		j.Stop()
+	}
+}
+
+// Stats returns a snapshot of the cache's counters.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Bytes:       c.nBytes,
+		MaxBytes:    c.maxBytes,
+		Items:       c.nItems,
+		Gets:        c.nGet,
+		Hits:        c.nHit,
+		Evictions:   c.nEvict,
+		Expirations: c.nExpiration,
+	}
+}
+
 func (c *Cache) OnEntryRemoved(key string, value strategy.Value) {
 	c.nBytes -= int64(len(key)) + int64(value.Len())
+	c.nItems--
+	switch c.removing {
+	case removalEvicted:
+		c.nEvict++
+	case removalExpired:
+		c.nExpiration++
+	}
 }
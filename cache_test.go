@@ -160,3 +160,72 @@ func TestCache_NilValue(t *testing.T) {
 		t.Fatal("should find key1 after add")
 	}
 }
+
+func TestCache_Janitor(t *testing.T) {
+	c := NewCache(1024, lru.New())
+	c.StartJanitor(10 * time.Millisecond)
+	defer c.Stop()
+
+	c.add("key1", ByteView{b: []byte("value1")}, time.Now().Add(20*time.Millisecond))
+	c.add("key2", ByteView{b: []byte("value2")}, time.Time{})
+
+	// 无需读取，过期条目应被主动清理
+	deadline := time.Now().Add(time.Second)
+	for {
+		c.mu.Lock()
+		nBytes := c.nBytes
+		c.mu.Unlock()
+		if nBytes == int64(len("key2")+len("value2")) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("janitor did not remove expired entry, nBytes = %d", nBytes)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCache_Stats(t *testing.T) {
+	k1, k2, k3 := "key1", "key2", "key3"
+	v := ByteView{b: []byte("value")}
+	c := NewCache(int64(2*(len(k1)+v.Len())), lru.New())
+
+	c.add(k1, v, time.Time{})
+	c.add(k2, v, time.Now().Add(-time.Second))
+	c.add(k1, v, time.Time{}) // 覆盖写入不算淘汰
+	c.add(k3, v, time.Time{}) // 淘汰 k2
+	c.get(k1)
+	c.get(k2)
+
+	want := CacheStats{
+		Bytes:     int64(2 * (len(k1) + v.Len())),
+		MaxBytes:  int64(2 * (len(k1) + v.Len())),
+		Items:     2,
+		Gets:      2,
+		Hits:      1,
+		Evictions: 1,
+	}
+	if got := c.Stats(); got != want {
+		t.Fatalf("Stats() = %+v, want %+v", got, want)
+	}
+
+	c = NewCache(1024, lru.New())
+	c.add(k1, v, time.Time{})
+	c.add(k2, v, time.Now().Add(-time.Second))
+	c.get(k2) // 读取时发现过期
+	c.add(k2, v, time.Now().Add(-time.Second))
+	c.add(k3, v, time.Time{})
+	c.removeExpired()
+	c.remove(k1) // 主动删除不算淘汰或过期
+
+	want = CacheStats{
+		Bytes:       int64(len(k3) + v.Len()),
+		MaxBytes:    1024,
+		Items:       1,
+		Gets:        1,
+		Expirations: 2,
+	}
+	if got := c.Stats(); got != want {
+		t.Fatalf("Stats() after expiry = %+v, want %+v", got, want)
+	}
+}
@@ -2,49 +2,285 @@ package consistenthash
 
 import (
 	"hash/crc32"
+	"maps"
+	"math"
+	"slices"
 	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 )
 
 type Hash func(data []byte) uint32
 
+// maxRehash bounds how many salted hashes are tried for a virtual node
+// whose hash is taken before it is left out.
+const maxRehash = 16
+
+// Map is a consistent hash ring. Get reads an immutable snapshot of the
+// ring, so it needs no lock and may run concurrently with Add and Remove,
+// which publish a rebuilt copy.
+//
+// The ring depends only on its nodes and their weights, not on the order
+// they were added in, so peers with the same membership agree on it. When
+// two virtual nodes hash to the same point, the one of the node with the
+// smaller name keeps it and the other is rehashed with a salt.
 type Map struct {
 	hash     Hash
 	replicas int
-	keys     []int
-	hashMap  map[int]string
+	mu       sync.Mutex // serializes writers
+	ring     atomic.Pointer[ring]
+}
+
+// ring is never modified once published.
+type ring struct {
+	keys       []int
+	hashMap    map[int]string
+	nodes      map[string]int // weight of each node
+	collisions int
+	dropped    int
+}
+
+// Stats describes the virtual nodes of a ring.
+type Stats struct {
+	Nodes        int
+	VirtualNodes int
+	// Collisions counts virtual nodes whose hash was taken and that were
+	// rehashed; Dropped counts those that found no free point and were
+	// left out.
+	Collisions int
+	Dropped    int
 }
 
 func New(replicas int, fn Hash) *Map {
 	m := &Map{
 		replicas: replicas,
 		hash:     fn,
-		hashMap:  make(map[int]string),
 	}
 	if m.hash == nil {
 		m.hash = crc32.ChecksumIEEE
 	}
+	m.ring.Store(&ring{
+		hashMap: make(map[int]string),
+		nodes:   make(map[string]int),
+	})
 	return m
 }
 
+// Add adds nodes to the ring with weight 1. Nodes already in the ring are
+// left as they are.
 func (m *Map) Add(keys ...string) {
-	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key
+	m.update(func(nodes map[string]int) {
+		for _, key := range keys {
+			if _, ok := nodes[key]; !ok {
+				nodes[key] = 1
+			}
+		}
+	})
+}
+
+// AddWeighted adds nodes with replicas*weight virtual nodes each, so that
+// a node's share of the keys is proportional to its weight. Nodes already
+// in the ring take their new weight; a weight of 0 or less removes a node.
+func (m *Map) AddWeighted(weights map[string]int) {
+	m.update(func(nodes map[string]int) {
+		for node, weight := range weights {
+			if weight > 0 {
+				nodes[node] = weight
+			} else {
+				delete(nodes, node)
+			}
+		}
+	})
+}
+
+// Remove removes nodes and their virtual nodes from the ring. Keys they
+// owned move to the next node on the ring; other keys stay where they are.
+func (m *Map) Remove(keys ...string) {
+	m.update(func(nodes map[string]int) {
+		for _, key := range keys {
+			delete(nodes, key)
+		}
+	})
+}
+
+// Set replaces the nodes of the ring with the nodes in weights, weighted as
+// by AddWeighted.
+func (m *Map) Set(weights map[string]int) {
+	m.update(func(nodes map[string]int) {
+		clear(nodes)
+		for node, weight := range weights {
+			if weight > 0 {
+				nodes[node] = weight
+			}
 		}
+	})
+}
+
+// Weight returns the weight of node, or 0 if it is not in the ring.
+func (m *Map) Weight(node string) int {
+	return m.ring.Load().nodes[node]
+}
+
+// Nodes returns the nodes in the ring, sorted.
+func (m *Map) Nodes() []string {
+	r := m.ring.Load()
+	nodes := make([]string, 0, len(r.nodes))
+	for node := range r.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// Stats reports the number of nodes and virtual nodes in the ring and the
+// hash collisions met while placing them.
+func (m *Map) Stats() Stats {
+	r := m.ring.Load()
+	return Stats{
+		Nodes:        len(r.nodes),
+		VirtualNodes: len(r.keys),
+		Collisions:   r.collisions,
+		Dropped:      r.dropped,
+	}
+}
+
+// Distribution returns the share of the hash space owned by each node, as
+// a fraction of 1. With a uniform hash a node's share of the keys tends to
+// its share of the hash space.
+func (m *Map) Distribution() map[string]float64 {
+	r := m.ring.Load()
+	shares := make(map[string]float64, len(r.nodes))
+	if len(r.keys) == 0 {
+		return shares
+	}
+	const space = 1 << 32
+	// the first point also owns the arc that wraps around zero
+	prev := r.keys[len(r.keys)-1] - space
+	for _, hash := range r.keys {
+		shares[r.hashMap[hash]] += float64(hash-prev) / space
+		prev = hash
 	}
-	sort.Ints(m.keys)
+	return shares
 }
 
 func (m *Map) Get(key string) string {
-	if len(m.keys) == 0 {
+	r := m.ring.Load()
+	if len(r.keys) == 0 {
 		return ""
 	}
 	hash := int(m.hash([]byte(key)))
-	idx := sort.Search(len(m.keys), func(i int) bool {
-		return m.keys[i] >= hash
+	idx := sort.Search(len(r.keys), func(i int) bool {
+		return r.keys[i] >= hash
 	})
-	return m.hashMap[m.keys[idx%len(m.keys)]]
+	return r.hashMap[r.keys[idx%len(r.keys)]]
+}
+
+// GetN returns up to n distinct nodes for key, walking clockwise from its
+// owner, which comes first. They are the replicas of the key.
+func (m *Map) GetN(key string, n int) []string {
+	r := m.ring.Load()
+	if len(r.keys) == 0 || n <= 0 {
+		return nil
+	}
+	n = min(n, len(r.nodes))
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(r.keys), func(i int) bool {
+		return r.keys[i] >= hash
+	})
+	nodes := make([]string, 0, n)
+	for i := 0; i < len(r.keys) && len(nodes) < n; i++ {
+		node := r.hashMap[r.keys[(idx+i)%len(r.keys)]]
+		if !slices.Contains(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// GetWithLoad is like Get, but implements consistent hashing with bounded
+// loads (Mirrokni et al.): a node may have at most ceil(c * average load)
+// requests in flight, scaled by its weight, where the average counts the
+// request being placed. If the owner of key is full, the next node
+// clockwise with room is returned instead. load reports the requests in
+// flight to a node; c must be above 1, e.g. 1.25.
+func (m *Map) GetWithLoad(key string, c float64, load func(node string) int64) string {
+	r := m.ring.Load()
+	if len(r.keys) == 0 {
+		return ""
+	}
+	total, weights := int64(1), 0
+	loads := make(map[string]int64, len(r.nodes))
+	for node, weight := range r.nodes {
+		loads[node] = load(node)
+		total += loads[node]
+		weights += weight
+	}
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(r.keys), func(i int) bool {
+		return r.keys[i] >= hash
+	})
+	for i := 0; i < len(r.keys); i++ {
+		node := r.hashMap[r.keys[(idx+i)%len(r.keys)]]
+		capacity := math.Ceil(c * float64(total) * float64(r.nodes[node]) / float64(weights))
+		if float64(loads[node]) < capacity {
+			return node
+		}
+	}
+	return r.hashMap[r.keys[idx%len(r.keys)]]
+}
+
+// update publishes a ring rebuilt from the node weights as changed by fn.
+func (m *Map) update(fn func(nodes map[string]int)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	nodes := maps.Clone(m.ring.Load().nodes)
+	fn(nodes)
+	m.ring.Store(m.build(nodes))
+}
+
+// build places the virtual nodes of nodes in order of node name, so that
+// collisions resolve the same way whatever order nodes were added in.
+func (m *Map) build(nodes map[string]int) *ring {
+	names := make([]string, 0, len(nodes))
+	size := 0
+	for node, weight := range nodes {
+		names = append(names, node)
+		size += m.replicas * weight
+	}
+	sort.Strings(names)
+
+	r := &ring{
+		keys:    make([]int, 0, size),
+		hashMap: make(map[int]string, size),
+		nodes:   nodes,
+	}
+	for _, node := range names {
+		for i := 0; i < m.replicas*nodes[node]; i++ {
+			m.place(r, node, strconv.Itoa(i)+node)
+		}
+	}
+	sort.Ints(r.keys)
+	return r
+}
+
+// place adds the virtual node vnode of node at the first free point among
+// its hash and its salted rehashes.
+func (m *Map) place(r *ring, node, vnode string) {
+	hash := int(m.hash([]byte(vnode)))
+	if _, taken := r.hashMap[hash]; taken {
+		r.collisions++
+		for salt := 1; ; salt++ {
+			if salt > maxRehash {
+				r.dropped++
+				return
+			}
+			hash = int(m.hash([]byte(strconv.Itoa(salt) + "#" + vnode)))
+			if _, taken = r.hashMap[hash]; !taken {
+				break
+			}
+		}
+	}
+	r.keys = append(r.keys, hash)
+	r.hashMap[hash] = node
 }
@@ -1,7 +1,10 @@
 package consistenthash
 
 import (
+	"hash/crc32"
+	"slices"
 	"strconv"
+	"sync"
 	"testing"
 )
 
@@ -41,3 +44,222 @@ func TestHashing(t *testing.T) {
 	}
 
 }
+
+func TestRemove(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+
+	// 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+	hash.Remove("4")
+
+	// 只有原本属于 4 的 key 发生迁移
+	testCases := map[string]string{
+		"2":  "2",
+		"3":  "6",
+		"11": "2",
+		"13": "6",
+		"23": "6",
+		"27": "2",
+	}
+	for k, v := range testCases {
+		if got := hash.Get(k); got != v {
+			t.Errorf("Asking for %s, got %s, want %s", k, got, v)
+		}
+	}
+	if nodes := hash.Nodes(); len(nodes) != 2 || nodes[0] != "2" || nodes[1] != "6" {
+		t.Errorf("Nodes() = %v, want [2 6]", nodes)
+	}
+
+	hash.Remove("6", "2")
+	if got := hash.Get("2"); got != "" {
+		t.Errorf("empty ring yielded %q", got)
+	}
+}
+
+func TestConcurrentUpdate(t *testing.T) {
+	hash := New(50, nil)
+	hash.Add("a", "b", "c")
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				// 读取不加锁，节点变化期间只会返回存在过的节点
+				if node := hash.Get("key"); node != "a" && node != "b" && node != "c" && node != "d" {
+					t.Errorf("unexpected node %q", node)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		hash.Add("d")
+		hash.Remove("d")
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestAddWeighted(t *testing.T) {
+	hash := New(100, nil)
+	weights := map[string]int{"a": 1, "b": 2, "c": 4}
+	hash.AddWeighted(weights)
+
+	// key 的分布与权重成正比
+	const n = 70000
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[hash.Get("key-"+strconv.Itoa(i))]++
+	}
+	for node, weight := range weights {
+		want := float64(n) * float64(weight) / 7
+		if got := float64(counts[node]); got < want*0.8 || got > want*1.2 {
+			t.Errorf("node %s got %d keys, want about %.0f", node, counts[node], want)
+		}
+	}
+
+	// 调整权重后只有该节点的份额变化
+	hash.AddWeighted(map[string]int{"c": 1})
+	if got := hash.Weight("c"); got != 1 {
+		t.Fatalf("Weight(c) = %d, want 1", got)
+	}
+	counts = make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[hash.Get("key-"+strconv.Itoa(i))]++
+	}
+	if counts["c"] > counts["b"] || counts["c"]*3 < counts["a"]*2 {
+		t.Errorf("unexpected distribution after reweight: %v", counts)
+	}
+
+	// 权重为 0 时移除节点
+	hash.AddWeighted(map[string]int{"a": 0})
+	if nodes := hash.Nodes(); len(nodes) != 2 || nodes[0] != "b" || nodes[1] != "c" {
+		t.Errorf("Nodes() = %v, want [b c]", nodes)
+	}
+}
+
+func TestCollision(t *testing.T) {
+	// "0a" 与 "0b" 的哈希相同，其余虚拟节点各不相同
+	fn := func(key []byte) uint32 {
+		switch string(key) {
+		case "0a", "0b":
+			return 10
+		case "1#0b":
+			return 20
+		}
+		return crc32.ChecksumIEEE(key)
+	}
+
+	hash1 := New(2, fn)
+	hash1.Add("a", "b")
+	hash2 := New(2, fn)
+	hash2.Add("b")
+	hash2.Add("a")
+
+	// 冲突的解决与加入顺序无关，名字小的节点保留原位置
+	for _, hash := range []*Map{hash1, hash2} {
+		r := hash.ring.Load()
+		if r.hashMap[10] != "a" {
+			t.Errorf("point 10 owned by %q, want a", r.hashMap[10])
+		}
+		if r.hashMap[20] != "b" {
+			t.Errorf("colliding virtual node of b should be rehashed to 20")
+		}
+		stats := hash.Stats()
+		if stats.VirtualNodes != 4 || stats.Collisions != 1 || stats.Dropped != 0 {
+			t.Errorf("Stats() = %+v", stats)
+		}
+	}
+
+	// 移除胜出的节点后，另一节点回到原位置
+	hash1.Remove("a")
+	if stats := hash1.Stats(); stats.Collisions != 0 || stats.VirtualNodes != 2 {
+		t.Errorf("Stats() after Remove = %+v", stats)
+	}
+}
+
+func TestDistribution(t *testing.T) {
+	hash := New(100, nil)
+	hash.AddWeighted(map[string]int{"a": 1, "b": 3})
+
+	shares := hash.Distribution()
+	if total := shares["a"] + shares["b"]; total < 0.999999 || total > 1.000001 {
+		t.Fatalf("shares add up to %v, want 1", total)
+	}
+	if shares["a"] < 0.15 || shares["a"] > 0.35 {
+		t.Errorf("share of a = %v, want about 0.25", shares["a"])
+	}
+	if len(New(1, nil).Distribution()) != 0 {
+		t.Errorf("empty ring should have no shares")
+	}
+}
+
+func TestGetWithLoad(t *testing.T) {
+	hash := New(1, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 虚拟节点 "02", "04", "06" 的哈希为 2, 4, 6
+	hash.Add("2", "4", "6")
+	loads := map[string]int64{}
+	load := func(node string) int64 { return loads[node] }
+
+	if got := hash.GetWithLoad("3", 1.25, load); got != "4" {
+		t.Fatalf("idle ring: got %s, want 4", got)
+	}
+
+	// 总负载 6+1，容量为 ceil(1.25*7/3)=3，4 已满，顺时针交给 6
+	loads["4"] = 3
+	loads["2"] = 3
+	if got := hash.GetWithLoad("3", 1.25, load); got != "6" {
+		t.Fatalf("owner full: got %s, want 6", got)
+	}
+	// 负载均衡后容量随平均负载增长，key 回到原节点
+	loads["6"] = 3
+	if got := hash.GetWithLoad("3", 1.25, load); got != "4" {
+		t.Fatalf("even load: got %s, want the owner 4", got)
+	}
+	if got := New(1, nil).GetWithLoad("3", 1.25, load); got != "" {
+		t.Fatalf("empty ring yielded %q", got)
+	}
+}
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+
+	testCases := []struct {
+		key  string
+		n    int
+		want []string
+	}{
+		{"11", 2, []string{"2", "4"}},
+		{"15", 3, []string{"6", "2", "4"}},
+		{"27", 5, []string{"2", "4", "6"}},
+		{"3", 0, nil},
+	}
+	for _, tc := range testCases {
+		got := hash.GetN(tc.key, tc.n)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("GetN(%s, %d) = %v, want %v", tc.key, tc.n, got, tc.want)
+		}
+		if len(got) > 0 && got[0] != hash.Get(tc.key) {
+			t.Errorf("GetN(%s) should start with the owner %s", tc.key, hash.Get(tc.key))
+		}
+	}
+}
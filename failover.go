@@ -0,0 +1,208 @@
+package distributed_cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for requests to a peer whose circuit breaker
+// is open.
+var ErrCircuitOpen = errors.New("distributed_cache: peer circuit open")
+
+// PeerFailurePolicy sets what a Group does when it cannot fetch a key from
+// a peer. The zero value asks each replica once, in order, and then loads
+// the key from the getter.
+type PeerFailurePolicy struct {
+	// Retries is how many more times a failing peer is asked before moving
+	// on. The first retry waits Backoff, each later one twice as long as
+	// the one before.
+	Retries int
+	Backoff time.Duration
+	// OwnerOnly gives up after the owner instead of trying its replicas.
+	OwnerOnly bool
+	// BreakAfter opens a peer's circuit after that many consecutive
+	// failures. The peer is then skipped for BreakFor, after which a single
+	// request is let through to test it. Zero never opens the circuit.
+	BreakAfter int
+	BreakFor   time.Duration
+	// FailFast returns the last peer error instead of loading the key from
+	// the getter once no peer could serve it.
+	FailFast bool
+}
+
+// callPeer runs call against peer under the group's failure policy,
+// skipping the peer while its circuit is open and retrying it with backoff.
+func (g *Group) callPeer(ctx context.Context, peer interface{}, call func() error) error {
+	policy := g.failurePolicy
+	b := g.breaker(peer)
+	if !b.allow() {
+		g.stats.CircuitSkips.Add(1)
+		g.Log("Circuit of peer %v is open, skipping it", peer)
+		return ErrCircuitOpen
+	}
+	backoff := policy.Backoff
+	for attempt := 0; ; attempt++ {
+		err := call()
+		if err == nil || errors.Is(err, ErrNotFound) {
+			b.success()
+			return err
+		}
+		// the peer's own breaker turned the request away
+		if errors.Is(err, ErrCircuitOpen) {
+			b.abandon()
+			return err
+		}
+		if ctx.Err() != nil {
+			b.abandon()
+			return err
+		}
+		if b.failure() {
+			g.stats.CircuitOpens.Add(1)
+			g.Log("Opened circuit of peer %v for %v: %v", peer, policy.BreakFor, err)
+			return err
+		}
+		if attempt >= policy.Retries {
+			return err
+		}
+		g.stats.PeerRetries.Add(1)
+		g.Log("Peer %v failed, retrying in %v: %v", peer, backoff, err)
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		backoff *= 2
+		if !b.allow() {
+			return err
+		}
+	}
+}
+
+// breaker returns the circuit breaker of peer, or nil if the policy never
+// opens circuits. Peers must be comparable, as pointers are.
+func (g *Group) breaker(peer interface{}) *circuitBreaker {
+	if g.failurePolicy.BreakAfter <= 0 {
+		return nil
+	}
+	if b, ok := g.breakers.Load(peer); ok {
+		return b.(*circuitBreaker)
+	}
+	b, _ := g.breakers.LoadOrStore(peer, newCircuitBreaker(g.failurePolicy.BreakAfter, g.failurePolicy.BreakFor))
+	return b.(*circuitBreaker)
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker stops requests to a failing peer. It opens after
+// threshold consecutive failures, lets one trial request through once
+// cooldown has passed, and closes again when the trial succeeds. A nil
+// circuitBreaker never opens.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	trial    bool // a half-open trial is in flight
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a request may go out now.
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.trial = true
+		return true
+	case breakerHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	}
+	return true
+}
+
+// open reports whether the breaker turns requests away, that is whether
+// it is open and still cooling down.
+func (b *circuitBreaker) open() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == breakerOpen && time.Since(b.openedAt) < b.cooldown
+}
+
+// success records a successful request and reports whether it closed the
+// circuit.
+func (b *circuitBreaker) success() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	closed := b.state != breakerClosed
+	b.state = breakerClosed
+	b.failures = 0
+	b.trial = false
+	return closed
+}
+
+// failure records a failed request and reports whether it opened the
+// circuit. A failure while open, such as that of a health check, restarts
+// the cooldown.
+func (b *circuitBreaker) failure() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == breakerOpen {
+		b.openedAt = time.Now()
+		return false
+	}
+	if b.state == breakerHalfOpen || b.state == breakerClosed && b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+		b.trial = false
+		return true
+	}
+	return false
+}
+
+// abandon forgets a request that ended without telling whether the peer
+// works, such as one whose caller gave up.
+func (b *circuitBreaker) abandon() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.trial = false
+	b.mu.Unlock()
+}
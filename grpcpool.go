@@ -0,0 +1,216 @@
+package distributed_cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"distributed-cache/consistenthash"
+	pb "distributed-cache/gen/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCPool implements PeerPicker for a pool of gRPC peers, and serves
+// GroupCacheService to them once registered on a grpc.Server.
+type GRPCPool struct {
+	// this peer's address, e.g. "10.0.0.1:8001"
+	self        string
+	dialOpts    []grpc.DialOption
+	mu          sync.Mutex
+	peers       *consistenthash.Map
+	grpcGetters map[string]*grpcGetter
+}
+
+// NewGRPCPool initializes a gRPC pool of peers. Connections are insecure
+// unless opts supply transport credentials.
+func NewGRPCPool(self string, opts ...grpc.DialOption) *GRPCPool {
+	return &GRPCPool{
+		self:     self,
+		dialOpts: append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...),
+	}
+}
+
+// Log info with server name
+func (p *GRPCPool) Log(format string, v ...interface{}) {
+	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
+
+// Register serves GroupCacheService on s.
+func (p *GRPCPool) Register(s grpc.ServiceRegistrar) {
+	pb.RegisterGroupCacheServiceServer(s, &grpcServer{pool: p})
+}
+
+// Set updates the pool's list of peers, closing connections to peers that
+// were dropped.
+func (p *GRPCPool) Set(peers ...string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	getters := make(map[string]*grpcGetter, len(peers))
+	for _, peer := range peers {
+		if g, ok := p.grpcGetters[peer]; ok {
+			getters[peer] = g
+			continue
+		}
+		conn, err := grpc.NewClient(peer, p.dialOpts...)
+		if err != nil {
+			closeGetters(getters, p.grpcGetters)
+			return fmt.Errorf("dialing peer %s: %v", peer, err)
+		}
+		getters[peer] = &grpcGetter{conn: conn, client: pb.NewGroupCacheServiceClient(conn)}
+	}
+	closeGetters(p.grpcGetters, getters)
+	p.peers = consistenthash.New(defaultReplicas, nil)
+	p.peers.Add(peers...)
+	p.grpcGetters = getters
+	return nil
+}
+
+// PickPeer picks a peer according to key
+func (p *GRPCPool) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+		p.Log("Pick peer %s", peer)
+		return p.grpcGetters[peer], true
+	}
+	return nil, false
+}
+
+// Close closes the connections to all peers.
+func (p *GRPCPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	closeGetters(p.grpcGetters, nil)
+	p.peers = nil
+	p.grpcGetters = nil
+}
+
+// closeGetters closes the getters in getters that are not in keep.
+func closeGetters(getters, keep map[string]*grpcGetter) {
+	for peer, g := range getters {
+		if _, ok := keep[peer]; !ok {
+			g.conn.Close()
+		}
+	}
+}
+
+var _ PeerPicker = (*GRPCPool)(nil)
+
+type grpcGetter struct {
+	conn   *grpc.ClientConn
+	client pb.GroupCacheServiceClient
+}
+
+func (g *grpcGetter) String() string {
+	return g.conn.Target()
+}
+
+func (g *grpcGetter) Get(in *pb.GetRequest, out *pb.GetResponse) error {
+	return g.GetContext(context.Background(), in, out)
+}
+
+func (g *grpcGetter) GetContext(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	res, err := g.client.Get(ctx, in)
+	if err != nil {
+		return err
+	}
+	out.Value, out.Expire, out.NotFound = res.GetValue(), res.GetExpire(), res.GetNotFound()
+	return nil
+}
+
+func (g *grpcGetter) Set(ctx context.Context, in *pb.SetRequest, out *pb.SetResponse) error {
+	_, err := g.client.Set(ctx, in)
+	return err
+}
+
+func (g *grpcGetter) Remove(ctx context.Context, in *pb.RemoveRequest, out *pb.RemoveResponse) error {
+	_, err := g.client.Remove(ctx, in)
+	return err
+}
+
+func (g *grpcGetter) GetMany(ctx context.Context, in *pb.GetManyRequest, out *pb.GetManyResponse) error {
+	res, err := g.client.GetMany(ctx, in)
+	if err != nil {
+		return err
+	}
+	out.Results = res.GetResults()
+	return nil
+}
+
+var (
+	_ PeerGetter        = (*grpcGetter)(nil)
+	_ ContextPeerGetter = (*grpcGetter)(nil)
+	_ PeerUpdater       = (*grpcGetter)(nil)
+	_ PeerBatchGetter   = (*grpcGetter)(nil)
+)
+
+// grpcServer dispatches GroupCacheService calls to the named groups.
+type grpcServer struct {
+	pb.UnimplementedGroupCacheServiceServer
+	pool *GRPCPool
+}
+
+func (s *grpcServer) group(name string) (*Group, error) {
+	group := GetGroup(name)
+	if group == nil {
+		return nil, status.Error(codes.NotFound, "no such group: "+name)
+	}
+	return group, nil
+}
+
+func (s *grpcServer) Get(ctx context.Context, in *pb.GetRequest) (*pb.GetResponse, error) {
+	s.pool.Log("Get %s/%s", in.GetGroup(), in.GetKey())
+	group, err := s.group(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	group.stats.ServerRequests.Add(1)
+	// only peers call this service, so never forward the key again
+	view, err := group.GetContext(serveLocally(ctx), in.GetKey())
+	if errors.Is(err, ErrNotFound) {
+		return &pb.GetResponse{NotFound: true}, nil
+	}
+	if err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	return &pb.GetResponse{Value: view.ByteSlice(), Expire: unixNano(view.Expire())}, nil
+}
+
+func (s *grpcServer) Set(ctx context.Context, in *pb.SetRequest) (*pb.SetResponse, error) {
+	s.pool.Log("Set %s/%s", in.GetGroup(), in.GetKey())
+	group, err := s.group(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	// the sender routed the key here, so store it without re-picking
+	group.setLocally(in.GetKey(), in.GetValue(), fromUnixNano(in.GetExpire()))
+	return &pb.SetResponse{}, nil
+}
+
+func (s *grpcServer) Remove(ctx context.Context, in *pb.RemoveRequest) (*pb.RemoveResponse, error) {
+	s.pool.Log("Remove %s/%s", in.GetGroup(), in.GetKey())
+	group, err := s.group(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	group.removeLocally(in.GetKey())
+	return &pb.RemoveResponse{}, nil
+}
+
+func (s *grpcServer) GetMany(ctx context.Context, in *pb.GetManyRequest) (*pb.GetManyResponse, error) {
+	s.pool.Log("GetMany %s (%d keys)", in.GetGroup(), len(in.GetKeys()))
+	group, err := s.group(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	group.stats.ServerRequests.Add(1)
+	return getManyResponse(group.GetMany(serveLocally(ctx), in.GetKeys())), nil
+}
@@ -0,0 +1,201 @@
+package distributed_cache
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	pb "distributed-cache/gen/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// 启动一个基于内存连接的 gRPC 服务端
+func startBufconnServer(t *testing.T, pool *GRPCPool) *bufconn.Listener {
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	pool.Register(s)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis
+}
+
+func bufconnDialer(listeners map[string]*bufconn.Listener) grpc.DialOption {
+	return grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		lis, ok := listeners[addr]
+		if !ok {
+			return nil, fmt.Errorf("unknown peer %s", addr)
+		}
+		return lis.DialContext(ctx)
+	})
+}
+
+func TestGRPCPool_Server(t *testing.T) {
+	expire := time.Now().Add(time.Hour)
+	g := NewGroup("grpc-scores", 2<<10, ExpireGetterFunc(
+		func(ctx context.Context, key string) ([]byte, time.Time, error) {
+			if key == "Tom" {
+				return []byte("630"), expire, nil
+			}
+			if key == "Nobody" {
+				return nil, time.Time{}, ErrNotFound
+			}
+			return nil, time.Time{}, fmt.Errorf("key not found")
+		}))
+
+	server := NewGRPCPool("server")
+	listeners := map[string]*bufconn.Listener{"server": startBufconnServer(t, server)}
+
+	client := NewGRPCPool("client", bufconnDialer(listeners))
+	if err := client.Set("passthrough:///server"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	defer client.Close()
+
+	peer, ok := client.PickPeer("Tom")
+	if !ok {
+		t.Fatalf("expect the only peer to be picked")
+	}
+	ctx := context.Background()
+
+	t.Run("get", func(t *testing.T) {
+		var out pb.GetResponse
+		if err := peer.Get(&pb.GetRequest{Group: "grpc-scores", Key: "Tom"}, &out); err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if string(out.GetValue()) != "630" || out.GetExpire() != expire.UnixNano() {
+			t.Fatalf("got value %q expire %d", out.GetValue(), out.GetExpire())
+		}
+	})
+
+	t.Run("no such group", func(t *testing.T) {
+		err := peer.Get(&pb.GetRequest{Group: "invalid-group", Key: "Tom"}, &pb.GetResponse{})
+		if status.Code(err) != codes.NotFound {
+			t.Fatalf("expect NotFound, got %v", err)
+		}
+	})
+
+	t.Run("loader error", func(t *testing.T) {
+		if err := peer.Get(&pb.GetRequest{Group: "grpc-scores", Key: "unknown"}, &pb.GetResponse{}); err == nil {
+			t.Fatalf("expect error when key not exist")
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		var out pb.GetResponse
+		if err := peer.Get(&pb.GetRequest{Group: "grpc-scores", Key: "Nobody"}, &out); err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if !out.GetNotFound() {
+			t.Fatalf("expect not_found in response")
+		}
+	})
+
+	t.Run("set and remove", func(t *testing.T) {
+		updater := peer.(PeerUpdater)
+		err := updater.Set(ctx, &pb.SetRequest{Group: "grpc-scores", Key: "Jack", Value: []byte("589")}, &pb.SetResponse{})
+		if err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+		if view, ok := g.mainCache.get("Jack"); !ok || view.String() != "589" {
+			t.Fatalf("Set did not store value on owner")
+		}
+		err = updater.Remove(ctx, &pb.RemoveRequest{Group: "grpc-scores", Key: "Jack"}, &pb.RemoveResponse{})
+		if err != nil {
+			t.Fatalf("Remove() error = %v", err)
+		}
+		if _, ok := g.mainCache.get("Jack"); ok {
+			t.Fatalf("Remove did not evict value on owner")
+		}
+	})
+
+	t.Run("get many", func(t *testing.T) {
+		var out pb.GetManyResponse
+		err := peer.(PeerBatchGetter).GetMany(ctx, &pb.GetManyRequest{Group: "grpc-scores", Keys: []string{"Tom", "unknown"}}, &out)
+		if err != nil {
+			t.Fatalf("GetMany() error = %v", err)
+		}
+		results := out.GetResults()
+		if len(results) != 2 || string(results[0].GetValue()) != "630" || results[1].GetError() == "" {
+			t.Fatalf("unexpected results %v", results)
+		}
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		err := peer.(ContextPeerGetter).GetContext(cctx, &pb.GetRequest{Group: "grpc-scores", Key: "Tom"}, &pb.GetResponse{})
+		if status.Code(err) != codes.Canceled {
+			t.Fatalf("expect Canceled, got %v", err)
+		}
+	})
+}
+
+func TestGRPCPool_Set(t *testing.T) {
+	pool := NewGRPCPool("localhost:8001")
+	defer pool.Close()
+	peers := []string{"localhost:8001", "localhost:8002", "localhost:8003"}
+	if err := pool.Set(peers...); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	kept := pool.grpcGetters["localhost:8002"]
+
+	// 更新节点列表时复用未变化节点的连接
+	if err := pool.Set("localhost:8001", "localhost:8002"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if len(pool.grpcGetters) != 2 {
+		t.Fatalf("wrong number of peers: got %v, want 2", len(pool.grpcGetters))
+	}
+	if pool.grpcGetters["localhost:8002"] != kept {
+		t.Fatalf("connection to unchanged peer should be reused")
+	}
+
+	for i := 0; i < 100; i++ {
+		if peer, ok := pool.PickPeer(fmt.Sprintf("key-%d", i)); ok && peer != kept {
+			t.Fatalf("picked a peer that is not in the pool")
+		}
+	}
+}
+
+func TestGRPCPool_ServeLocally(t *testing.T) {
+	g := NewGroup("grpc-forwarded", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("local"), nil
+		}), WithHotCacheBytes(0))
+
+	// 两个节点都认为对方是所有者，转发来的请求必须在本地处理，否则互相转发直到超时
+	listeners := map[string]*bufconn.Listener{}
+	a := NewGRPCPool("passthrough:///a", bufconnDialer(listeners))
+	b := NewGRPCPool("passthrough:///b", bufconnDialer(listeners))
+	listeners["a"] = startBufconnServer(t, a)
+	listeners["b"] = startBufconnServer(t, b)
+	if err := a.Set("passthrough:///b"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	defer a.Close()
+	if err := b.Set("passthrough:///a"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	defer b.Close()
+	g.RegisterPeers(a)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	peer, _ := b.PickPeer("Tom")
+	var out pb.GetResponse
+	if err := peer.(ContextPeerGetter).GetContext(ctx, &pb.GetRequest{Group: "grpc-forwarded", Key: "Tom"}, &out); err != nil || string(out.GetValue()) != "local" {
+		t.Fatalf("Get() = %q, %v, want local", out.GetValue(), err)
+	}
+	var many pb.GetManyResponse
+	if err := peer.(PeerBatchGetter).GetMany(ctx, &pb.GetManyRequest{Group: "grpc-forwarded", Keys: []string{"Jack"}}, &many); err != nil {
+		t.Fatalf("GetMany() error = %v", err)
+	}
+	if r := many.GetResults(); len(r) != 1 || string(r[0].GetValue()) != "local" {
+		t.Fatalf("GetMany() results = %v, want local", r)
+	}
+}
@@ -1,14 +1,26 @@
 package distributed_cache
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
 	"sync"
 	"time"
 
 	pb "distributed-cache/gen/v1"
 	"distributed-cache/singleflight"
+	"distributed-cache/strategy"
+	"distributed-cache/strategy/lru"
 )
 
+// ErrNotFound is returned by a Getter for keys that don't exist at the
+// origin. The group caches the miss for its negative TTL, so repeated
+// requests for the key don't reach the getter.
+var ErrNotFound = errors.New("distributed_cache: key not found")
+
 type Getter interface {
 	Get(key string) ([]byte, error)
 }
@@ -19,30 +31,272 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// ContextGetter loads data for a key on behalf of a caller whose deadline
+// and cancellation are carried by ctx.
+type ContextGetter interface {
+	GetContext(ctx context.Context, key string) ([]byte, error)
+}
+
+type ContextGetterFunc func(ctx context.Context, key string) ([]byte, error)
+
+func (f ContextGetterFunc) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+// Get implements Getter so a ContextGetterFunc can be passed to NewGroup.
+func (f ContextGetterFunc) Get(key string) ([]byte, error) {
+	return f(context.Background(), key)
+}
+
+// ExpireGetter loads data for a key together with the time it expires.
+// A zero expire means the value never expires.
+type ExpireGetter interface {
+	GetExpire(ctx context.Context, key string) (value []byte, expire time.Time, err error)
+}
+
+type ExpireGetterFunc func(ctx context.Context, key string) ([]byte, time.Time, error)
+
+func (f ExpireGetterFunc) GetExpire(ctx context.Context, key string) ([]byte, time.Time, error) {
+	return f(ctx, key)
+}
+
+// Get implements Getter so an ExpireGetterFunc can be passed to NewGroup.
+func (f ExpireGetterFunc) Get(key string) ([]byte, error) {
+	b, _, err := f(context.Background(), key)
+	return b, err
+}
+
+// getterAdapter lets a plain Getter serve the context-aware loading path.
+type getterAdapter struct {
+	Getter
+}
+
+func (a getterAdapter) GetContext(_ context.Context, key string) ([]byte, error) {
+	return a.Get(key)
+}
+
+// contextGetterAdapter lets a ContextGetter serve values that never expire.
+type contextGetterAdapter struct {
+	ContextGetter
+}
+
+func (a contextGetterAdapter) GetExpire(ctx context.Context, key string) ([]byte, time.Time, error) {
+	b, err := a.GetContext(ctx, key)
+	return b, time.Time{}, err
+}
+
+func toExpireGetter(getter Getter) ExpireGetter {
+	switch g := getter.(type) {
+	case ExpireGetter:
+		return g
+	case ContextGetter:
+		return contextGetterAdapter{g}
+	default:
+		return contextGetterAdapter{getterAdapter{getter}}
+	}
+}
+
 type Group struct {
-	name      string
-	getter    Getter
+	name   string
+	getter ExpireGetter
+	// mainCache holds the keys this node owns; hotCache holds copies of
+	// popular keys owned by peers, to save a round trip per request.
 	mainCache Cache
+	hotCache  Cache
 	peers     PeerPicker
 	sf        *singleflight.Group
+	stats     Stats
+
+	defaultTTL     time.Duration
+	ttlJitter      time.Duration
+	negativeTTL    time.Duration
+	staleTTL       time.Duration
+	expiryInterval time.Duration
+	// earlyRefreshBeta scales the XFetch early refresh; 0 disables it
+	earlyRefreshBeta float64
+
+	// refreshing holds the keys being reloaded in the background after
+	// serving them stale.
+	refreshMu  sync.Mutex
+	refreshing map[string]struct{}
+
+	// loads holds the context of each key's shared load
+	loadsMu sync.Mutex
+	loads   map[string]*sharedLoad
+
+	// writes holds the write generation of the keys being loaded, so that
+	// loads don't store values older than a Set or Remove
+	writesMu sync.Mutex
+	writes   map[string]*keyWrites
+
+	// cacheBytes bounds both caches; hotCacheBytes is their split, with a
+	// negative value meaning the default
+	cacheBytes          int64
+	hotCacheBytes       int64
+	hotCacheProbability float64
+	hotCacheTTL         time.Duration
+
+	// clock tells the time expiries are checked against; nil means time.Now
+	clock strategy.Clock
+
+	failurePolicy PeerFailurePolicy
+	breakers      sync.Map // peer -> *circuitBreaker
+}
+
+type GroupOption func(*Group)
+
+// WithDefaultTTL bounds the lifetime of locally loaded values for which the
+// getter reports no expiry.
+func WithDefaultTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.defaultTTL = ttl
+	}
+}
+
+// WithTTLJitter extends the default TTL of each locally loaded value by a
+// random duration in [0, jitter), so that values loaded together don't
+// expire together. Expiries returned by the getter are never changed.
+func WithTTLJitter(jitter time.Duration) GroupOption {
+	return func(g *Group) {
+		g.ttlJitter = jitter
+	}
+}
+
+// WithNegativeTTL sets how long an ErrNotFound from the getter is cached;
+// the default is 10 seconds. Zero disables negative caching.
+func WithNegativeTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.negativeTTL = ttl
+	}
+}
+
+// WithStaleTTL keeps values in the main cache for ttl past their expiry.
+// Until then, Get returns an expired value right away and reloads it in the
+// background; if the reload fails, the expired value is served again.
+func WithStaleTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.staleTTL = ttl
+	}
+}
+
+// WithEarlyRefresh reloads values in the background shortly before they
+// expire, so that hot keys are refreshed before they lapse. A hit triggers
+// the reload with the XFetch probability, which grows as expiry nears and
+// with how long the value took to load; beta scales it, 1 being a good
+// default. Zero disables early refresh.
+func WithEarlyRefresh(beta float64) GroupOption {
+	return func(g *Group) {
+		g.earlyRefreshBeta = beta
+	}
+}
+
+// WithExpiryInterval makes the group sweep expired entries out of its cache
+// every interval until Stop is called.
+func WithExpiryInterval(interval time.Duration) GroupOption {
+	return func(g *Group) {
+		g.expiryInterval = interval
+	}
+}
+
+// WithHotCacheBytes sets how much of the group's cacheBytes is reserved for
+// the hot cache. By default a group reserves an eighth once peers are
+// registered, and nothing before. Zero disables the hot cache.
+func WithHotCacheBytes(n int64) GroupOption {
+	return func(g *Group) {
+		g.hotCacheBytes = n
+	}
+}
+
+// WithHotCacheEviction sets the eviction strategy of the hot cache, which
+// is LRU by default.
+func WithHotCacheEviction(eviction strategy.EvictionStrategy) GroupOption {
+	return func(g *Group) {
+		g.hotCache.eviction = eviction
+		eviction.SetRemover(&g.hotCache)
+	}
+}
+
+// WithHotCacheProbability sets the chance that a value fetched from a peer
+// is kept in the hot cache; the default is 0.1.
+func WithHotCacheProbability(p float64) GroupOption {
+	return func(g *Group) {
+		g.hotCacheProbability = p
+	}
+}
+
+// WithClock sets the clock the group and its default eviction strategies
+// check expiries against; tests inject a fake one. A strategy passed to
+// WithHotCacheEviction needs to be given the clock itself.
+func WithClock(clock strategy.Clock) GroupOption {
+	return func(g *Group) {
+		g.clock = clock
+	}
+}
+
+// WithPeerFailurePolicy sets what the group does when a peer fails to
+// serve a key; see PeerFailurePolicy.
+func WithPeerFailurePolicy(policy PeerFailurePolicy) GroupOption {
+	return func(g *Group) {
+		g.failurePolicy = policy
+	}
 }
 
+// WithHotCacheTTL bounds how long a value fetched from a peer stays in the
+// hot cache, even if it expires later or never; the default is a minute.
+// Set, Remove and Invalidate don't reach the hot caches of other nodes, so
+// this also bounds how long they serve a value that was replaced. Zero
+// keeps values until they expire.
+func WithHotCacheTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.hotCacheTTL = ttl
+	}
+}
+
+const (
+	defaultNegativeTTL = 10 * time.Second
+	defaultHotCacheTTL = time.Minute
+)
+
 var (
 	mu     sync.RWMutex
 	groups = make(map[string]*Group)
 )
 
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+// NewGroup creates a Group backed by getter. If getter also implements
+// ContextGetter, loads receive the caller's context; if it implements
+// ExpireGetter, loaded values expire when it says so. cacheBytes bounds
+// the main and hot caches together.
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
 	mu.Lock()
 	defer mu.Unlock()
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: Cache{maxBytes: cacheBytes},
-		sf:        &singleflight.Group{},
+		name:                name,
+		getter:              toExpireGetter(getter),
+		sf:                  &singleflight.Group{},
+		negativeTTL:         defaultNegativeTTL,
+		cacheBytes:          cacheBytes,
+		hotCacheBytes:       -1,
+		hotCacheProbability: 0.1,
+		hotCacheTTL:         defaultHotCacheTTL,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	if g.clock != nil {
+		for _, c := range []*Cache{&g.mainCache, &g.hotCache} {
+			if c.eviction == nil {
+				c.eviction = lru.New(lru.WithClock(g.clock))
+				c.eviction.SetRemover(c)
+			}
+		}
+	}
+	g.splitCacheBytes()
+	if g.expiryInterval > 0 {
+		g.mainCache.StartJanitor(g.expiryInterval)
+		g.hotCache.StartJanitor(g.expiryInterval)
 	}
 	groups[name] = g
 	return g
@@ -55,16 +309,201 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+func (g *Group) now() time.Time {
+	if g.clock == nil {
+		return time.Now()
+	}
+	return g.clock.Now()
+}
+
+// Log info with group name
+func (g *Group) Log(format string, v ...interface{}) {
+	log.Printf("[Group %s] %s", g.name, fmt.Sprintf(format, v...))
+}
+
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get but aborts peer fetches and loader work once ctx
+// is done.
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
+	g.stats.Gets.Add(1)
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
 
+	if v, which, ok := g.lookupCache(key); ok {
+		return g.cacheHit(key, v, which)
+	}
+
+	return g.load(ctx, key)
+}
+
+// cacheHit counts a hit in the cache which and returns the value, or
+// ErrNotFound if the entry is a tombstone. An expired value starts a
+// background refresh.
+func (g *Group) cacheHit(key string, v ByteView, which CacheType) (ByteView, error) {
+	g.stats.CacheHits.Add(1)
+	if v.notFound {
+		g.stats.NegativeHits.Add(1)
+		return ByteView{}, ErrNotFound
+	}
+	if e := v.Expire(); !e.IsZero() {
+		if now := g.now(); now.After(e) {
+			g.stats.StaleHits.Add(1)
+			g.refresh(key, which)
+		} else if g.refreshEarly(now, v) {
+			g.stats.EarlyRefreshes.Add(1)
+			g.refresh(key, which)
+		}
+	}
+	return v, nil
+}
+
+// refreshEarly reports whether a value that has not expired yet should be
+// reloaded now, using the XFetch rule: now - delta*beta*ln(rand) >= expiry.
+func (g *Group) refreshEarly(now time.Time, v ByteView) bool {
+	if g.earlyRefreshBeta <= 0 || v.delta <= 0 {
+		return false
+	}
+	gap := -float64(v.delta) * g.earlyRefreshBeta * math.Log(1-rand.Float64())
+	return float64(v.e.Sub(now)) <= gap
+}
+
+// refresh reloads key in the background unless a refresh is already
+// running, and stores the result in the cache which, where the hit found
+// the old value. On failure the stale value stays in the cache.
+func (g *Group) refresh(key string, which CacheType) {
+	g.refreshMu.Lock()
+	if _, ok := g.refreshing[key]; ok {
+		g.refreshMu.Unlock()
+		return
+	}
+	if g.refreshing == nil {
+		g.refreshing = make(map[string]struct{})
+	}
+	g.refreshing[key] = struct{}{}
+	g.refreshMu.Unlock()
+
+	go func() {
+		defer func() {
+			g.refreshMu.Lock()
+			delete(g.refreshing, key)
+			g.refreshMu.Unlock()
+		}()
+		gen := g.beginLoad(key)
+		defer g.endLoad(key)
+		// not a cache miss, so not counted in Loads
+		g.stats.Refreshes.Add(1)
+		v, err := g.loadFrom(context.Background(), key, nil, nil)
+		if err != nil {
+			g.stats.RefreshErrs.Add(1)
+			return
+		}
+		// A load keeps values fetched from peers in the hot cache only by
+		// chance; without the write a hot key would keep refreshing. For
+		// local loads of the main cache this repeats the load's write.
+		g.storeLoaded(key, gen, func() {
+			if which == HotCache {
+				g.addToHotCache(key, v)
+			} else {
+				g.populateCache(key, v)
+			}
+		})
+	}()
+}
+
+// lookupCache returns the cached value of key and the cache holding it.
+func (g *Group) lookupCache(key string) (ByteView, CacheType, bool) {
 	if v, ok := g.mainCache.get(key); ok {
-		return v, nil
+		return v, MainCache, true
+	}
+	if g.hotCache.maxBytes > 0 {
+		if v, ok := g.hotCache.get(key); ok {
+			return v, HotCache, true
+		}
 	}
+	return ByteView{}, 0, false
+}
 
-	return g.load(key)
+// KeyResult is the outcome of loading one key with GetMany.
+type KeyResult struct {
+	Key   string
+	Value ByteView
+	Err   error
+}
+
+// GetMany loads keys in one pass. Misses owned by a peer that supports
+// batching are fetched with a single request per peer; the others are loaded
+// as Get would. Results are in the order of keys.
+func (g *Group) GetMany(ctx context.Context, keys []string) []KeyResult {
+	results := make([]KeyResult, len(keys))
+	byPeer := make(map[PeerBatchGetter][]int)
+	var rest []int
+	for i, key := range keys {
+		results[i].Key = key
+		g.stats.Gets.Add(1)
+		if key == "" {
+			results[i].Err = fmt.Errorf("key is required")
+			continue
+		}
+		if v, which, ok := g.lookupCache(key); ok {
+			results[i].Value, results[i].Err = g.cacheHit(key, v, which)
+			continue
+		}
+		if g.peers != nil && !servedLocally(ctx) {
+			if peer, ok := g.peers.PickPeer(key); ok {
+				if bp, ok := peer.(PeerBatchGetter); ok {
+					g.stats.Loads.Add(1)
+					byPeer[bp] = append(byPeer[bp], i)
+					continue
+				}
+			}
+		}
+		rest = append(rest, i)
+	}
+
+	var wg sync.WaitGroup
+	for peer, idx := range byPeer {
+		wg.Add(1)
+		go func(peer PeerBatchGetter, idx []int) {
+			defer wg.Done()
+			g.getManyFromPeer(ctx, peer, keys, idx, results)
+		}(peer, idx)
+	}
+	for _, i := range rest {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i].Value, results[i].Err = g.load(ctx, keys[i])
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// Stats returns the group's counters.
+func (g *Group) Stats() *Stats {
+	return &g.stats
+}
+
+// CacheStats returns stats about the provided cache within the group.
+func (g *Group) CacheStats(which CacheType) CacheStats {
+	switch which {
+	case MainCache:
+		return g.mainCache.Stats()
+	case HotCache:
+		return g.hotCache.Stats()
+	default:
+		return CacheStats{}
+	}
+}
+
+// Stop releases the group's background resources.
+func (g *Group) Stop() {
+	g.mainCache.Stop()
+	g.hotCache.Stop()
 }
 
 func (g *Group) RegisterPeers(peers PeerPicker) {
@@ -72,49 +511,544 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 		panic("RegisterPeerPicker called more than once")
 	}
 	g.peers = peers
+	g.splitCacheBytes()
 }
 
-func (g *Group) load(key string) (value ByteView, err error) {
-	view, err := g.sf.Do(key, func() (interface{}, error) {
+// splitCacheBytes divides cacheBytes between the main and hot caches. A
+// group without peers has nothing to copy into the hot cache, so by default
+// it gets nothing until peers are registered.
+func (g *Group) splitCacheBytes() {
+	hot := g.hotCacheBytes
+	if hot < 0 {
+		hot = 0
 		if g.peers != nil {
-			if peer, ok := g.peers.PickPeer(key); ok {
-				if value, err = g.getFromPeer(peer, key); err == nil {
-					return value, nil
+			hot = g.cacheBytes / 8
+		}
+	}
+	hot = max(0, min(hot, g.cacheBytes))
+	g.mainCache.maxBytes = g.cacheBytes - hot
+	g.hotCache.maxBytes = hot
+}
+
+func (g *Group) load(ctx context.Context, key string) (ByteView, error) {
+	g.stats.Loads.Add(1)
+	return g.loadFrom(ctx, key, nil, nil)
+}
+
+// loadFrom loads key from the peers holding it in order, skipping tried,
+// and from the getter if none of them answers and the failure policy
+// allows it. peerErr is the error of tried, if any. The load is shared
+// with concurrent callers for the same key.
+func (g *Group) loadFrom(callerCtx context.Context, key string, tried interface{}, peerErr error) (ByteView, error) {
+	if err := callerCtx.Err(); err != nil {
+		return ByteView{}, err
+	}
+	ctx := g.joinLoad(callerCtx, key)
+	defer g.leaveLoad(key)
+	// waiters whose ctx is done return without waiting for the shared load
+	view, err := g.sf.DoContext(callerCtx, key, func() (interface{}, error) {
+		g.stats.LoadsDeduped.Add(1)
+		gen := g.beginLoad(key)
+		defer g.endLoad(key)
+		lastErr := peerErr
+		for i, peer := range g.pickPeers(ctx, key) {
+			if tried != nil && peer == tried {
+				continue
+			}
+			if lastErr != nil {
+				if g.failurePolicy.OwnerOnly {
+					break
 				}
+				g.stats.PeerFailovers.Add(1)
+				g.Log("Loading %s from replica %v after: %v", key, peer, lastErr)
+			}
+			value, err := g.getFromPeer(ctx, peer, key)
+			if err == nil {
+				g.stats.PeerLoads.Add(1)
+				if i > 0 {
+					g.stats.ReplicaLoads.Add(1)
+				}
+				g.maybePopulateHotCache(key, gen, value)
+				return value, nil
+			}
+			// the owner already asked the origin
+			if errors.Is(err, ErrNotFound) {
+				g.stats.PeerLoads.Add(1)
+				return nil, err
+			}
+			if !errors.Is(err, ErrCircuitOpen) {
+				g.stats.PeerErrors.Add(1)
+			}
+			// The caller gave up; don't fall back to the origin.
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			lastErr = err
+		}
+		if lastErr != nil {
+			if g.failurePolicy.FailFast {
+				g.stats.FailFasts.Add(1)
+				g.Log("No peer could serve %s, failing fast: %v", key, lastErr)
+				return nil, lastErr
 			}
+			g.stats.PeerFallbacks.Add(1)
+			g.Log("No peer could serve %s, loading it locally: %v", key, lastErr)
 		}
-		return g.getLocally(key)
+		return g.getLocally(ctx, key, gen)
 	})
-	if err == nil {
-		return view.(ByteView), nil
+	if err != nil {
+		var perr *singleflight.PanicError
+		if errors.As(err, &perr) {
+			g.Log("Loading %s panicked: %v\n\n%s", key, perr.Value, perr.Stack)
+		}
+		return ByteView{}, err
+	}
+	return view.(ByteView), nil
+}
+
+type serveLocallyKey struct{}
+
+// serveLocally marks ctx as that of a request a peer forwarded here, to be
+// served from this node's cache or getter. The peer picked this node, maybe
+// passing over the owner under bounded loads, so asking the owner again
+// would add a hop and could bounce the request between peers.
+func serveLocally(ctx context.Context) context.Context {
+	return context.WithValue(ctx, serveLocallyKey{}, true)
+}
+
+func servedLocally(ctx context.Context) bool {
+	local, _ := ctx.Value(serveLocallyKey{}).(bool)
+	return local
+}
+
+// sharedLoad is the context of the loads of a key, cancelled once every
+// caller waiting for them has given up.
+type sharedLoad struct {
+	ctx     *loadContext
+	cancel  context.CancelFunc
+	waiters int
+}
+
+// joinLoad returns the context to load key with. It keeps the values of
+// the first caller's ctx but not its cancellation, so that one caller
+// giving up doesn't fail the others.
+func (g *Group) joinLoad(ctx context.Context, key string) context.Context {
+	g.loadsMu.Lock()
+	defer g.loadsMu.Unlock()
+	l, ok := g.loads[key]
+	if !ok {
+		if g.loads == nil {
+			g.loads = make(map[string]*sharedLoad)
+		}
+		l = &sharedLoad{ctx: &loadContext{}}
+		l.ctx.Context, l.cancel = context.WithCancel(context.WithoutCancel(ctx))
+		g.loads[key] = l
+	}
+	l.ctx.join(ctx)
+	l.waiters++
+	return l.ctx
+}
+
+// loadContext is the context of a shared load. Its deadline is the latest
+// of its callers', or none once a caller without one joins, so that peers
+// and getters stop working on a load nobody waits for anymore.
+type loadContext struct {
+	context.Context
+
+	mu        sync.Mutex
+	deadline  time.Time
+	unbounded bool
+}
+
+// join extends the deadline to that of ctx.
+func (c *loadContext) join(ctx context.Context) {
+	d, ok := ctx.Deadline()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !ok {
+		c.unbounded = true
+	} else if d.After(c.deadline) {
+		c.deadline = d
+	}
+}
+
+func (c *loadContext) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.unbounded {
+		return time.Time{}, false
 	}
-	return
+	return c.deadline, true
 }
 
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key)
+// Err reports the load as timed out once its last caller's deadline passed.
+func (c *loadContext) Err() error {
+	err := c.Context.Err()
+	if d, ok := c.Deadline(); err != nil && ok && !time.Now().Before(d) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// leaveLoad cancels the load of key once its last caller has left.
+func (g *Group) leaveLoad(key string) {
+	g.loadsMu.Lock()
+	defer g.loadsMu.Unlock()
+	l := g.loads[key]
+	if l.waiters--; l.waiters > 0 {
+		return
+	}
+	delete(g.loads, key)
+	l.cancel()
+	// callers arriving from now on must not join the cancelled load
+	g.sf.Forget(key)
+}
+
+// pickPeers returns the peers to load key from in order: its replicas if
+// the PeerPicker knows them, or else its owner. There are none for requests
+// a peer forwarded here.
+func (g *Group) pickPeers(ctx context.Context, key string) []PeerGetter {
+	if g.peers == nil || servedLocally(ctx) {
+		return nil
+	}
+	if rp, ok := g.peers.(ReplicaPicker); ok {
+		return rp.PickPeers(key)
+	}
+	if peer, ok := g.peers.PickPeer(key); ok {
+		return []PeerGetter{peer}
+	}
+	return nil
+}
+
+// loadCounter is implemented by PeerPickers that weigh this peer's own
+// load, counting the loads from the getter while they run.
+type loadCounter interface {
+	startLoad() (done func())
+}
+
+// getLocally loads key from the getter and stores it unless key was
+// written since the write generation gen.
+func (g *Group) getLocally(ctx context.Context, key string, gen uint64) (ByteView, error) {
+	if err := ctx.Err(); err != nil {
+		return ByteView{}, err
+	}
+	// the picker counted forwarded requests when they came in
+	if lc, ok := g.peers.(loadCounter); ok && !servedLocally(ctx) {
+		defer lc.startLoad()()
+	}
+	start := time.Now()
+	bytes, expire, err := g.getter.GetExpire(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		g.stats.NotFounds.Add(1)
+		if g.negativeTTL > 0 {
+			g.storeLoaded(key, gen, func() {
+				g.populateCache(key, ByteView{e: g.now().Add(g.negativeTTL), notFound: true})
+			})
+		}
+		return ByteView{}, err
+	}
 	if err != nil {
+		g.stats.LocalLoadErrs.Add(1)
 		return ByteView{}, err
 
 	}
-	value := ByteView{b: cloneBytes(bytes)}
-	g.populateCache(key, value)
+	g.stats.LocalLoads.Add(1)
+	value := ByteView{b: cloneBytes(bytes), e: g.localExpire(expire), delta: time.Since(start)}
+	g.storeLoaded(key, gen, func() { g.populateCache(key, value) })
 	return value, nil
 }
 
+// localExpire applies the group's default TTL and jitter to values for
+// which the getter reported no expiry. An expiry the getter reported is
+// absolute and kept as is.
+func (g *Group) localExpire(expire time.Time) time.Time {
+	if !expire.IsZero() || g.defaultTTL <= 0 {
+		return expire
+	}
+	expire = g.now().Add(g.defaultTTL)
+	if g.ttlJitter > 0 {
+		expire = expire.Add(time.Duration(rand.Int64N(int64(g.ttlJitter))))
+	}
+	return expire
+}
+
+// populateCache stores value in the main cache, keeping it past its expiry
+// for the group's stale TTL. Tombstones are never served stale.
 func (g *Group) populateCache(key string, value ByteView) {
-	g.mainCache.add(key, value, time.Time{})
+	expire := value.e
+	if !expire.IsZero() && !value.notFound {
+		expire = expire.Add(g.staleTTL)
+	}
+	g.mainCache.add(key, value, expire)
+}
+
+// maybePopulateHotCache keeps a peer's value with the group's hot cache
+// probability, so that only frequently requested keys tend to stay local.
+// Values of keys written since the write generation gen are dropped.
+func (g *Group) maybePopulateHotCache(key string, gen uint64, value ByteView) {
+	if g.hotCache.maxBytes <= 0 || rand.Float64() >= g.hotCacheProbability {
+		return
+	}
+	g.storeLoaded(key, gen, func() { g.addToHotCache(key, value) })
+}
+
+// addToHotCache stores a peer's value in the hot cache until it expires or
+// for the hot cache TTL, whichever comes first.
+func (g *Group) addToHotCache(key string, value ByteView) {
+	expire := value.e
+	if g.hotCacheTTL > 0 {
+		if bound := g.now().Add(g.hotCacheTTL); expire.IsZero() || expire.After(bound) {
+			expire = bound
+		}
+	}
+	g.hotCache.add(key, value, expire)
 }
 
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
 	req := &pb.GetRequest{
 		Group: g.name,
 		Key:   key,
 	}
-	res := &pb.GetResponse{}
-	err := peer.Get(req, res)
+	var res *pb.GetResponse
+	var delta time.Duration
+	err := g.callPeer(ctx, peer, func() error {
+		res = &pb.GetResponse{}
+		start := time.Now()
+		defer func() {
+			delta = time.Since(start)
+			g.stats.PeerLatency.Observe(delta)
+		}()
+		if cp, ok := peer.(ContextPeerGetter); ok {
+			return cp.GetContext(ctx, req, res)
+		}
+		return peer.Get(req, res)
+	})
 	if err != nil {
 		return ByteView{}, err
 	}
-	return ByteView{b: res.Value}, nil
+	if res.NotFound {
+		return ByteView{}, ErrNotFound
+	}
+	return ByteView{b: res.Value, e: fromUnixNano(res.Expire), delta: delta}, nil
+}
+
+// Set stores value for key on the node that owns it. A zero expire means
+// the value never expires. Other nodes keep serving copies of the old value
+// from their hot caches for up to their hot cache TTL.
+func (g *Group) Set(ctx context.Context, key string, value []byte, expire time.Time) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	peer, err := g.pickUpdater(key)
+	if err != nil {
+		return err
+	}
+	if peer != nil {
+		req := &pb.SetRequest{Group: g.name, Key: key, Value: value, Expire: unixNano(expire)}
+		if err := peer.Set(ctx, req, &pb.SetResponse{}); err != nil {
+			return err
+		}
+		// drop copies this node holds in its hot cache or loaded while the
+		// owner was unreachable
+		g.removeLocally(key)
+		return nil
+	}
+	g.setLocally(key, value, expire)
+	return nil
+}
+
+// Remove evicts key from the node that owns it and from this one. Like
+// Set, it leaves copies in the hot caches of other nodes, which last for
+// their hot cache TTL.
+func (g *Group) Remove(ctx context.Context, key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	peer, err := g.pickUpdater(key)
+	if err != nil {
+		return err
+	}
+	if peer != nil {
+		req := &pb.RemoveRequest{Group: g.name, Key: key}
+		if err := peer.Remove(ctx, req, &pb.RemoveResponse{}); err != nil {
+			return err
+		}
+	}
+	g.removeLocally(key)
+	return nil
+}
+
+// Invalidate evicts key from this node and from the node that owns it, so
+// that copies loaded during a peer outage are dropped as well. It doesn't
+// reach the hot caches of other nodes; see WithHotCacheTTL.
+func (g *Group) Invalidate(ctx context.Context, key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	// evict the local copies even if the owner can't be reached
+	g.removeLocally(key)
+	return g.Remove(ctx, key)
+}
+
+// pickUpdater returns the remote owner of key, or nil if this node owns it.
+func (g *Group) pickUpdater(key string) (PeerUpdater, error) {
+	if g.peers == nil {
+		return nil, nil
+	}
+	var peer PeerGetter
+	var ok bool
+	if op, isOwner := g.peers.(OwnerPicker); isOwner {
+		peer, ok = op.PickOwner(key)
+	} else {
+		peer, ok = g.peers.PickPeer(key)
+	}
+	if !ok {
+		return nil, nil
+	}
+	updater, ok := peer.(PeerUpdater)
+	if !ok {
+		return nil, fmt.Errorf("peer owning key %s does not accept updates", key)
+	}
+	return updater, nil
+}
+
+func (g *Group) setLocally(key string, value []byte, expire time.Time) {
+	g.write(key, func() { g.populateCache(key, ByteView{b: cloneBytes(value), e: expire}) })
+}
+
+func (g *Group) removeLocally(key string) {
+	g.write(key, func() {
+		g.mainCache.remove(key)
+		g.hotCache.remove(key)
+	})
+}
+
+// keyWrites counts the writes to a key while it is being loaded.
+type keyWrites struct {
+	gen   uint64
+	loads int
+}
+
+// beginLoad registers a load of key and returns the write generation it
+// started at. endLoad must be called once the load stored its result.
+func (g *Group) beginLoad(key string) uint64 {
+	g.writesMu.Lock()
+	defer g.writesMu.Unlock()
+	w, ok := g.writes[key]
+	if !ok {
+		if g.writes == nil {
+			g.writes = make(map[string]*keyWrites)
+		}
+		w = &keyWrites{}
+		g.writes[key] = w
+	}
+	w.loads++
+	return w.gen
+}
+
+func (g *Group) endLoad(key string) {
+	g.writesMu.Lock()
+	defer g.writesMu.Unlock()
+	w := g.writes[key]
+	if w.loads--; w.loads == 0 {
+		delete(g.writes, key)
+	}
+}
+
+// storeLoaded runs store unless key was written since the write
+// generation gen, so that a load never overwrites a newer Set or Remove.
+func (g *Group) storeLoaded(key string, gen uint64, store func()) {
+	g.writesMu.Lock()
+	defer g.writesMu.Unlock()
+	if w, ok := g.writes[key]; ok && w.gen != gen {
+		return
+	}
+	store()
+}
+
+// write runs a Set or Remove of key, dropping the results of the loads in
+// flight. Callers arriving later start a new load instead of joining them.
+func (g *Group) write(key string, write func()) {
+	g.writesMu.Lock()
+	defer g.writesMu.Unlock()
+	if w, ok := g.writes[key]; ok {
+		w.gen++
+		g.sf.Forget(key)
+	}
+	write()
+}
+
+// getManyFromPeer fills results[i] for each i in idx with a single batched
+// request, loading the keys the peer could not serve from the other
+// replicas or locally.
+func (g *Group) getManyFromPeer(ctx context.Context, peer PeerBatchGetter, keys []string, idx []int, results []KeyResult) {
+	req := &pb.GetManyRequest{Group: g.name, Keys: make([]string, len(idx))}
+	gens := make([]uint64, len(idx))
+	for j, i := range idx {
+		req.Keys[j] = keys[i]
+		gens[j] = g.beginLoad(keys[i])
+		defer g.endLoad(keys[i])
+	}
+	var res *pb.GetManyResponse
+	err := g.callPeer(ctx, peer, func() error {
+		res = &pb.GetManyResponse{}
+		start := time.Now()
+		defer func() { g.stats.PeerLatency.Observe(time.Since(start)) }()
+		return peer.GetMany(ctx, req, res)
+	})
+	found := make(map[string]*pb.GetResult, len(idx))
+	if err == nil {
+		for _, r := range res.GetResults() {
+			found[r.GetKey()] = r
+		}
+	}
+	for j, i := range idx {
+		if r, ok := found[keys[i]]; ok && r.GetError() == "" {
+			g.stats.LoadsDeduped.Add(1)
+			g.stats.PeerLoads.Add(1)
+			if r.GetNotFound() {
+				results[i].Err = ErrNotFound
+				continue
+			}
+			results[i].Value = ByteView{b: r.GetValue(), e: fromUnixNano(r.GetExpire())}
+			g.maybePopulateHotCache(keys[i], gens[j], results[i].Value)
+			continue
+		}
+		if !errors.Is(err, ErrCircuitOpen) {
+			g.stats.PeerErrors.Add(1)
+		}
+		// as in load, the caller giving up means no fallback to the origin
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			continue
+		}
+		keyErr := err
+		if keyErr == nil {
+			keyErr = fmt.Errorf("peer returned no value for %q", keys[i])
+			if r, ok := found[keys[i]]; ok {
+				keyErr = errors.New(r.GetError())
+			}
+		}
+		// try the replicas other than the peer the batch went to
+		results[i].Value, results[i].Err = g.loadFrom(ctx, keys[i], peer, keyErr)
+	}
+}
+
+// getManyResponse encodes results for a peer that asked for a batch.
+func getManyResponse(results []KeyResult) *pb.GetManyResponse {
+	res := &pb.GetManyResponse{Results: make([]*pb.GetResult, len(results))}
+	for i, r := range results {
+		res.Results[i] = &pb.GetResult{Key: r.Key}
+		if errors.Is(r.Err, ErrNotFound) {
+			res.Results[i].NotFound = true
+			continue
+		}
+		if r.Err != nil {
+			res.Results[i].Error = r.Err.Error()
+			continue
+		}
+		res.Results[i].Value = r.Value.ByteSlice()
+		res.Results[i].Expire = unixNano(r.Value.Expire())
+	}
+	return res
 }
@@ -1,12 +1,18 @@
 package distributed_cache
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	pb "distributed-cache/gen/v1"
+	"distributed-cache/singleflight"
+	"distributed-cache/strategy/lfu"
 )
 
 // 模拟数据源
@@ -87,11 +93,13 @@ func (m *mockPeerPicker) PickPeer(key string) (PeerGetter, bool) {
 // 模拟 PeerGetter
 type mockPeerGetter struct {
 	mockData map[string][]byte
+	expire   int64
 }
 
 func (m *mockPeerGetter) Get(in *pb.GetRequest, out *pb.GetResponse) error {
 	if v, ok := m.mockData[in.Key]; ok {
 		out.Value = v
+		out.Expire = m.expire
 		return nil
 	}
 	return fmt.Errorf("key %s not found", in.Key)
@@ -151,3 +159,1226 @@ func TestConcurrentGet(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+type ctxKey struct{}
+
+func TestGetContext(t *testing.T) {
+	g := NewGroup("ctx-scores", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			v, _ := ctx.Value(ctxKey{}).(string)
+			return []byte(v), nil
+		}))
+
+	t.Run("context reaches loader", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), ctxKey{}, "traced")
+		view, err := g.GetContext(ctx, "Tom")
+		if err != nil || view.String() != "traced" {
+			t.Fatalf("GetContext() = %q, %v; want traced", view.String(), err)
+		}
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := g.GetContext(ctx, "Jack"); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expect context.Canceled, got %v", err)
+		}
+	})
+}
+
+func TestGetContextSharedLoad(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	g := NewGroup("ctx-shared", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			close(started)
+			select {
+			case <-release:
+				return []byte("630"), nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}))
+
+	// 第一个调用方发起加载，第二个调用方加入同一次加载
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := g.GetContext(ctx, "Tom")
+		first <- err
+	}()
+	<-started
+	second := make(chan ByteView, 1)
+	go func() {
+		view, err := g.GetContext(context.Background(), "Tom")
+		if err != nil {
+			t.Errorf("live caller got %v", err)
+		}
+		second <- view
+	}()
+	waitLoadWaiters(g, "Tom", 2)
+
+	// 第一个调用方取消后立即返回，不影响仍在等待的调用方
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled caller got %v, want context.Canceled", err)
+	}
+	close(release)
+	if view := <-second; view.String() != "630" {
+		t.Fatalf("live caller got %q, want 630", view.String())
+	}
+}
+
+// 等待 key 的共享加载有 n 个调用方
+func waitLoadWaiters(g *Group, key string, n int) {
+	for {
+		g.loadsMu.Lock()
+		l := g.loads[key]
+		done := l != nil && l.waiters == n
+		g.loadsMu.Unlock()
+		if done {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGetContextSharedLoadDeadline(t *testing.T) {
+	type deadline struct {
+		at time.Time
+		ok bool
+	}
+	probe := make(chan struct{})
+	deadlines := make(chan deadline)
+	release := make(chan struct{})
+	g := NewGroup("ctx-shared-deadline", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			for {
+				select {
+				case <-probe:
+					at, ok := ctx.Deadline()
+					deadlines <- deadline{at, ok}
+				case <-release:
+					return []byte("630"), nil
+				}
+			}
+		}))
+	get := func(ctx context.Context) {
+		if _, err := g.GetContext(ctx, "Tom"); err != nil {
+			t.Errorf("GetContext() error = %v", err)
+		}
+	}
+	check := func(want deadline) {
+		t.Helper()
+		probe <- struct{}{}
+		if got := <-deadlines; !got.at.Equal(want.at) || got.ok != want.ok {
+			t.Fatalf("load deadline = %v, %v, want %v, %v", got.at, got.ok, want.at, want.ok)
+		}
+	}
+
+	// 共享加载的截止时间取所有调用方中最晚的一个
+	now := time.Now()
+	early, cancelEarly := context.WithDeadline(context.Background(), now.Add(time.Hour))
+	defer cancelEarly()
+	late, cancelLate := context.WithDeadline(context.Background(), now.Add(2*time.Hour))
+	defer cancelLate()
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() { defer wg.Done(); get(early) }()
+	waitLoadWaiters(g, "Tom", 1)
+	check(deadline{now.Add(time.Hour), true})
+	go func() { defer wg.Done(); get(late) }()
+	waitLoadWaiters(g, "Tom", 2)
+	check(deadline{now.Add(2 * time.Hour), true})
+
+	// 有调用方没有截止时间时，共享加载也没有
+	go func() { defer wg.Done(); get(context.Background()) }()
+	waitLoadWaiters(g, "Tom", 3)
+	check(deadline{})
+	close(release)
+	wg.Wait()
+}
+
+// 模拟支持 context 的 PeerGetter
+type ctxPeerGetter struct {
+	mockPeerGetter
+	gotCtx context.Context
+}
+
+func (m *ctxPeerGetter) GetContext(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	m.gotCtx = ctx
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Get(in, out)
+}
+
+func TestGetContextFromPeer(t *testing.T) {
+	var localLoads int
+	g := NewGroup("ctx-peer", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			localLoads++
+			return []byte(key), nil
+		}))
+	peer := &ctxPeerGetter{mockPeerGetter: mockPeerGetter{mockData: map[string][]byte{"key1": []byte("value1")}}}
+	g.RegisterPeers(&mockPeerPicker{peer: peer})
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "traced")
+	if view, err := g.GetContext(ctx, "key1"); err != nil || view.String() != "value1" {
+		t.Fatalf("GetContext() = %q, %v; want value1", view.String(), err)
+	}
+	if peer.gotCtx == nil || peer.gotCtx.Value(ctxKey{}) != "traced" {
+		t.Fatalf("peer did not receive caller context")
+	}
+
+	// 调用方放弃后不应回源
+	cctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := g.GetContext(cctx, "key2"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+	if localLoads != 0 {
+		t.Fatalf("local getter called %d times after cancellation", localLoads)
+	}
+}
+
+func TestSetRemove(t *testing.T) {
+	loads := 0
+	g := NewGroup("writes", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte("origin"), nil
+		}))
+	ctx := context.Background()
+
+	if err := g.Set(ctx, "Tom", []byte("700"), time.Time{}); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if view, err := g.Get("Tom"); err != nil || view.String() != "700" {
+		t.Fatalf("Get() after Set = %q, %v; want 700", view.String(), err)
+	}
+	if loads != 0 {
+		t.Fatalf("Set value should be served without loading, loads = %d", loads)
+	}
+
+	// 覆盖写入
+	if err := g.Set(ctx, "Tom", []byte("710"), time.Time{}); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if view, _ := g.Get("Tom"); view.String() != "710" {
+		t.Fatalf("Get() after overwrite = %q, want 710", view.String())
+	}
+	if want := int64(len("Tom") + len("710")); g.mainCache.nBytes != want {
+		t.Fatalf("nBytes after overwrite = %d, want %d", g.mainCache.nBytes, want)
+	}
+
+	if err := g.Remove(ctx, "Tom"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if view, _ := g.Get("Tom"); view.String() != "origin" || loads != 1 {
+		t.Fatalf("Get() after Remove = %q with %d loads, want origin with 1", view.String(), loads)
+	}
+
+	if err := g.Invalidate(ctx, "Tom"); err != nil {
+		t.Fatalf("Invalidate() error = %v", err)
+	}
+	if _, ok := g.mainCache.get("Tom"); ok {
+		t.Fatalf("Invalidate() should evict Tom")
+	}
+}
+
+func TestSetRemoveRequiresUpdater(t *testing.T) {
+	g := NewGroup("writes-readonly", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	g.RegisterPeers(&mockPeerPicker{peer: &mockPeerGetter{}})
+
+	if err := g.Set(context.Background(), "Tom", []byte("700"), time.Time{}); err == nil {
+		t.Fatalf("Set() should fail when the owning peer cannot accept updates")
+	}
+}
+
+// 模拟接受写入的 PeerGetter
+type updaterPeerGetter struct {
+	countingPeerGetter
+}
+
+func (m *updaterPeerGetter) Set(ctx context.Context, in *pb.SetRequest, out *pb.SetResponse) error {
+	return nil
+}
+
+func (m *updaterPeerGetter) Remove(ctx context.Context, in *pb.RemoveRequest, out *pb.RemoveResponse) error {
+	return nil
+}
+
+func TestRemoveFromPeer(t *testing.T) {
+	g := NewGroup("writes-remote", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("origin"), nil
+		}), WithHotCacheBytes(1<<10), WithHotCacheProbability(1))
+	peer := &updaterPeerGetter{}
+	peer.mockData = map[string][]byte{"Tom": []byte("630")}
+	g.RegisterPeers(&mockPeerPicker{peer: peer})
+
+	// 所有者在远程时，Remove 同时清除本节点的热点副本
+	if _, err := g.Get("Tom"); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if err := g.Remove(context.Background(), "Tom"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if cs := g.CacheStats(HotCache); cs.Items != 0 {
+		t.Fatalf("Remove should drop the hot copy, got %+v", cs)
+	}
+}
+
+func TestWriteDuringLoad(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	g := NewGroup("writes-inflight", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			started <- struct{}{}
+			<-release
+			return []byte("old"), nil
+		}))
+	ctx := context.Background()
+
+	// 加载期间的 Set 不会被加载结果覆盖
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.Get("Tom")
+	}()
+	<-started
+	if err := g.Set(ctx, "Tom", []byte("new"), time.Time{}); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	release <- struct{}{}
+	<-done
+	if view, _ := g.Get("Tom"); view.String() != "new" {
+		t.Fatalf("Get() after Set during a load = %q, want new", view.String())
+	}
+
+	// 加载期间的 Remove 也不会被覆盖
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		g.Get("Jack")
+	}()
+	<-started
+	if err := g.Remove(ctx, "Jack"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	close(release)
+	<-done
+	if _, ok := g.mainCache.get("Jack"); ok {
+		t.Fatalf("a load started before Remove should not be cached")
+	}
+}
+
+func TestGetExpire(t *testing.T) {
+	loads := 0
+	g := NewGroup("ttl", 2<<10, ExpireGetterFunc(
+		func(ctx context.Context, key string) ([]byte, time.Time, error) {
+			loads++
+			return []byte(key), time.Now().Add(50 * time.Millisecond), nil
+		}))
+
+	view, err := g.Get("Tom")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if view.Expire().IsZero() {
+		t.Fatalf("loaded view should carry the loader's expiry")
+	}
+	if _, err := g.Get("Tom"); err != nil || loads != 1 {
+		t.Fatalf("unexpired value should be cached, loads = %d", loads)
+	}
+
+	// 等待过期后应重新回源
+	time.Sleep(100 * time.Millisecond)
+	if _, err := g.Get("Tom"); err != nil || loads != 2 {
+		t.Fatalf("expired value should be reloaded, loads = %d", loads)
+	}
+}
+
+func TestGetExpireFromPeer(t *testing.T) {
+	expire := time.Now().Add(time.Hour)
+	g := NewGroup("ttl-peer", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("should not reach local getter")
+		}))
+	g.RegisterPeers(&mockPeerPicker{peer: &mockPeerGetter{
+		mockData: map[string][]byte{"key1": []byte("value1")},
+		expire:   expire.UnixNano(),
+	}})
+
+	view, err := g.Get("key1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if !view.Expire().Equal(expire) {
+		t.Fatalf("peer expiry = %v, want %v", view.Expire(), expire)
+	}
+}
+
+func TestGroupDefaultTTL(t *testing.T) {
+	ttl, jitter := time.Minute, 10*time.Second
+	g := NewGroup("default-ttl", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithDefaultTTL(ttl), WithTTLJitter(jitter))
+
+	expires := make(map[time.Time]bool)
+	for i := 0; i < 20; i++ {
+		start := time.Now()
+		view, err := g.Get(fmt.Sprintf("key-%d", i))
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		lifetime := view.Expire().Sub(start)
+		if lifetime < ttl || lifetime > ttl+jitter+time.Second {
+			t.Fatalf("lifetime %v outside [%v, %v)", lifetime, ttl, ttl+jitter)
+		}
+		expires[view.Expire()] = true
+	}
+	// 抖动后过期时间不应全部相同
+	if len(expires) < 2 {
+		t.Fatalf("jitter should spread expiry times")
+	}
+
+	// 加载器给出的过期时间优先于默认 TTL，且不加抖动
+	expire := time.Now().Add(time.Hour)
+	g = NewGroup("default-ttl-override", 2<<10, ExpireGetterFunc(
+		func(ctx context.Context, key string) ([]byte, time.Time, error) {
+			return []byte(key), expire, nil
+		}), WithDefaultTTL(ttl), WithTTLJitter(jitter))
+	if view, _ := g.Get("Tom"); !view.Expire().Equal(expire) {
+		t.Fatalf("Expire() = %v, want the getter's expiry %v", view.Expire(), expire)
+	}
+}
+
+// 模拟支持批量读取的 PeerGetter
+type batchPeerGetter struct {
+	mockPeerGetter
+	mu    sync.Mutex
+	calls int
+}
+
+func (m *batchPeerGetter) GetMany(ctx context.Context, in *pb.GetManyRequest, out *pb.GetManyResponse) error {
+	m.mu.Lock()
+	m.calls++
+	m.mu.Unlock()
+	for _, key := range in.GetKeys() {
+		r := &pb.GetResult{Key: key}
+		if v, ok := m.mockData[key]; ok {
+			r.Value = v
+		} else {
+			r.Error = "not found"
+		}
+		out.Results = append(out.Results, r)
+	}
+	return nil
+}
+
+// 以 "remote-" 开头的 key 属于远程节点
+type prefixPeerPicker struct {
+	peer PeerGetter
+}
+
+func (m *prefixPeerPicker) PickPeer(key string) (PeerGetter, bool) {
+	if strings.HasPrefix(key, "remote-") {
+		return m.peer, true
+	}
+	return nil, false
+}
+
+func TestGetMany(t *testing.T) {
+	var mu sync.Mutex
+	var localKeys []string
+	g := NewGroup("batch", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			mu.Lock()
+			localKeys = append(localKeys, key)
+			mu.Unlock()
+			if key == "missing" {
+				return nil, fmt.Errorf("%s not exist", key)
+			}
+			return []byte("local-" + key), nil
+		}))
+	peer := &batchPeerGetter{mockPeerGetter: mockPeerGetter{mockData: map[string][]byte{
+		"remote-1": []byte("v1"),
+		"remote-2": []byte("v2"),
+		"remote-3": []byte("v3"),
+	}}}
+	g.RegisterPeers(&prefixPeerPicker{peer: peer})
+
+	keys := []string{"remote-1", "Tom", "remote-2", "", "remote-3", "missing", "remote-gone"}
+	want := []string{"v1", "local-Tom", "v2", "", "v3", "", "local-remote-gone"}
+	results := g.GetMany(context.Background(), keys)
+
+	if len(results) != len(keys) {
+		t.Fatalf("got %d results, want %d", len(results), len(keys))
+	}
+	for i, r := range results {
+		if r.Key != keys[i] {
+			t.Errorf("result %d key = %q, want %q", i, r.Key, keys[i])
+		}
+		if wantErr := keys[i] == "" || keys[i] == "missing"; (r.Err != nil) != wantErr {
+			t.Errorf("result %q error = %v, wantErr %v", r.Key, r.Err, wantErr)
+		}
+		if got := r.Value.String(); got != want[i] {
+			t.Errorf("result %q value = %q, want %q", r.Key, got, want[i])
+		}
+	}
+	// 同一节点的 key 只发起一次批量请求
+	if peer.calls != 1 {
+		t.Fatalf("peer batch calls = %d, want 1", peer.calls)
+	}
+	// 节点无法提供的 key 回源加载
+	if len(localKeys) != 3 {
+		t.Fatalf("local loads = %v, want Tom, missing and remote-gone", localKeys)
+	}
+
+	// 已缓存的 key 不再访问节点
+	results = g.GetMany(context.Background(), []string{"Tom", "remote-gone"})
+	if peer.calls != 1 || len(localKeys) != 3 {
+		t.Fatalf("cached keys should not be loaded again")
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatalf("cached key %q error = %v", r.Key, r.Err)
+		}
+	}
+}
+
+func TestGroupStats(t *testing.T) {
+	release := make(chan struct{})
+	g := NewGroup("stats", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "slow" {
+				<-release
+			}
+			if key == "missing" {
+				return nil, fmt.Errorf("%s not exist", key)
+			}
+			return []byte(key), nil
+		}))
+
+	g.Get("Tom")
+	g.Get("Tom")
+	g.Get("missing")
+
+	// 并发请求同一个 key 只回源一次
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Get("slow")
+		}()
+	}
+	for g.Stats().Loads.Get() < 7 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	stats := g.Stats()
+	checks := []struct {
+		name string
+		got  int64
+		want int64
+	}{
+		{"Gets", stats.Gets.Get(), 8},
+		{"CacheHits", stats.CacheHits.Get(), 1},
+		{"Loads", stats.Loads.Get(), 7},
+		{"LoadsDeduped", stats.LoadsDeduped.Get(), 3},
+		{"LocalLoads", stats.LocalLoads.Get(), 2},
+		{"LocalLoadErrs", stats.LocalLoadErrs.Get(), 1},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %d, want %d", c.name, c.got, c.want)
+		}
+	}
+
+	cs := g.CacheStats(MainCache)
+	if cs.Items != 2 || cs.Bytes != int64(len("Tom")*2+len("slow")*2) {
+		t.Errorf("CacheStats(MainCache) = %+v", cs)
+	}
+}
+
+func TestGroupStats_Peer(t *testing.T) {
+	g := NewGroup("stats-peer", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	g.RegisterPeers(&mockPeerPicker{peer: &mockPeerGetter{mockData: map[string][]byte{"key1": []byte("value1")}}})
+
+	g.Get("key1")
+	g.Get("unknown")
+
+	if got := g.Stats().PeerLoads.Get(); got != 1 {
+		t.Errorf("PeerLoads = %d, want 1", got)
+	}
+	if got := g.Stats().PeerErrors.Get(); got != 1 {
+		t.Errorf("PeerErrors = %d, want 1", got)
+	}
+	if got := g.Stats().LocalLoads.Get(); got != 1 {
+		t.Errorf("LocalLoads = %d, want 1", got)
+	}
+}
+
+// 统计远程节点被访问的次数
+type countingPeerGetter struct {
+	mockPeerGetter
+	mu    sync.Mutex
+	calls int
+}
+
+func (m *countingPeerGetter) Get(in *pb.GetRequest, out *pb.GetResponse) error {
+	m.mu.Lock()
+	m.calls++
+	m.mu.Unlock()
+	return m.mockPeerGetter.Get(in, out)
+}
+
+func TestHotCache(t *testing.T) {
+	newPeer := func() *countingPeerGetter {
+		return &countingPeerGetter{mockPeerGetter: mockPeerGetter{mockData: map[string][]byte{"key1": []byte("value1")}}}
+	}
+
+	t.Run("keeps peer values", func(t *testing.T) {
+		g := NewGroup("hot", 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				return nil, fmt.Errorf("should not reach local getter")
+			}), WithHotCacheProbability(1), WithHotCacheEviction(lfu.New()))
+		peer := newPeer()
+		g.RegisterPeers(&mockPeerPicker{peer: peer})
+
+		for i := 0; i < 3; i++ {
+			if view, err := g.Get("key1"); err != nil || view.String() != "value1" {
+				t.Fatalf("Get() = %q, %v", view.String(), err)
+			}
+		}
+		if peer.calls != 1 {
+			t.Fatalf("hot key should be fetched from peer once, got %d", peer.calls)
+		}
+		if cs := g.CacheStats(HotCache); cs.Items != 1 || cs.Hits != 2 {
+			t.Fatalf("CacheStats(HotCache) = %+v", cs)
+		}
+		if cs := g.CacheStats(MainCache); cs.Items != 0 {
+			t.Fatalf("peer value should not enter the main cache, got %+v", cs)
+		}
+
+		// 失效后重新从节点获取
+		if err := g.Invalidate(context.Background(), "key1"); err == nil {
+			t.Fatalf("mock peer cannot accept updates")
+		}
+		if cs := g.CacheStats(HotCache); cs.Items != 0 {
+			t.Fatalf("Invalidate should drop the hot copy, got %+v", cs)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		g := NewGroup("hot-disabled", 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				return nil, fmt.Errorf("should not reach local getter")
+			}), WithHotCacheBytes(0), WithHotCacheProbability(1))
+		peer := newPeer()
+		g.RegisterPeers(&mockPeerPicker{peer: peer})
+
+		g.Get("key1")
+		g.Get("key1")
+		if peer.calls != 2 {
+			t.Fatalf("without hot cache every Get goes to the peer, got %d calls", peer.calls)
+		}
+		if cs := g.CacheStats(MainCache); cs.MaxBytes != 2<<10 {
+			t.Fatalf("main cache should get the whole budget, got %+v", cs)
+		}
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		g := NewGroup("hot-ttl", 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				return nil, fmt.Errorf("should not reach local getter")
+			}), WithHotCacheProbability(1), WithHotCacheTTL(time.Nanosecond))
+		peer := newPeer()
+		g.RegisterPeers(&mockPeerPicker{peer: peer})
+
+		// 没有过期时间的值在热点缓存中也只保留 TTL 那么久
+		g.Get("key1")
+		g.Get("key1")
+		if peer.calls != 2 {
+			t.Fatalf("hot copy should lapse after the hot cache TTL, got %d peer calls", peer.calls)
+		}
+	})
+
+	t.Run("budget", func(t *testing.T) {
+		g := NewGroup("hot-budget", 1000, GetterFunc(
+			func(key string) ([]byte, error) {
+				return []byte(key), nil
+			}), WithHotCacheBytes(300))
+		if main, hot := g.CacheStats(MainCache).MaxBytes, g.CacheStats(HotCache).MaxBytes; main != 700 || hot != 300 {
+			t.Fatalf("budget split main=%d hot=%d, want 700 and 300", main, hot)
+		}
+
+		// 默认情况下，注册节点之前热点缓存不占用容量
+		g = NewGroup("hot-default", 1000, GetterFunc(
+			func(key string) ([]byte, error) {
+				return []byte(key), nil
+			}))
+		if main, hot := g.CacheStats(MainCache).MaxBytes, g.CacheStats(HotCache).MaxBytes; main != 1000 || hot != 0 {
+			t.Fatalf("split without peers main=%d hot=%d, want 1000 and 0", main, hot)
+		}
+		g.RegisterPeers(&mockPeerPicker{peer: &mockPeerGetter{}})
+		if main, hot := g.CacheStats(MainCache).MaxBytes, g.CacheStats(HotCache).MaxBytes; main != 875 || hot != 125 {
+			t.Fatalf("split with peers main=%d hot=%d, want 875 and 125", main, hot)
+		}
+	})
+}
+
+func TestNegativeCache(t *testing.T) {
+	var loads int
+	g := NewGroup("negative", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("loading %s: %w", key, ErrNotFound)
+		}), WithNegativeTTL(time.Minute))
+
+	// 不存在的 key 只访问一次数据源
+	for i := 0; i < 3; i++ {
+		if _, err := g.Get("unknown"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expect ErrNotFound, got %v", err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("not-found key loaded %d times, want 1", loads)
+	}
+	if got := g.Stats().NegativeHits.Get(); got != 2 {
+		t.Fatalf("NegativeHits = %d, want 2", got)
+	}
+
+	// 墓碑只占用 key 的大小，并带有负缓存 TTL
+	if got := g.CacheStats(MainCache).Bytes; got != int64(len("unknown")) {
+		t.Fatalf("tombstone charged %d bytes, want %d", got, len("unknown"))
+	}
+	view, _ := g.mainCache.get("unknown")
+	if until := time.Until(view.Expire()); until <= 0 || until > time.Minute {
+		t.Fatalf("tombstone expires in %v, want within %v", until, time.Minute)
+	}
+
+	// 写入会覆盖墓碑
+	if err := g.Set(context.Background(), "unknown", []byte("1"), time.Time{}); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if view, err := g.Get("unknown"); err != nil || view.String() != "1" {
+		t.Fatalf("Get() = %q, %v after Set", view.String(), err)
+	}
+
+	// 普通错误不缓存
+	g = NewGroup("negative-errors", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return nil, fmt.Errorf("db down")
+		}))
+	loads = 0
+	g.Get("Tom")
+	g.Get("Tom")
+	if loads != 2 {
+		t.Fatalf("errors should not be cached, loaded %d times", loads)
+	}
+
+	// TTL 为 0 时关闭负缓存
+	g = NewGroup("negative-disabled", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return nil, ErrNotFound
+		}), WithNegativeTTL(0))
+	loads = 0
+	g.Get("Tom")
+	g.Get("Tom")
+	if loads != 2 {
+		t.Fatalf("negative caching disabled, but loaded %d times", loads)
+	}
+}
+
+func TestNegativeCacheFromPeer(t *testing.T) {
+	g := NewGroup("negative-peer", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("should not reach local getter")
+		}))
+	g.RegisterPeers(&mockPeerPicker{peer: &notFoundPeerGetter{}})
+
+	// 远端确认不存在时不回退到本地加载
+	if _, err := g.Get("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, got %v", err)
+	}
+	if got := g.Stats().PeerErrors.Get(); got != 0 {
+		t.Fatalf("PeerErrors = %d, want 0", got)
+	}
+}
+
+type notFoundPeerGetter struct{}
+
+func (m *notFoundPeerGetter) Get(in *pb.GetRequest, out *pb.GetResponse) error {
+	out.NotFound = true
+	return nil
+}
+
+// 可手动推进的时钟，后台刷新会并发读取
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// waitRefresh waits for the background refresh of key to finish writing
+// its result back.
+func waitRefresh(t *testing.T, g *Group, key string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		g.refreshMu.Lock()
+		_, running := g.refreshing[key]
+		g.refreshMu.Unlock()
+		if !running {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("refresh of %s did not finish", key)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		loads int
+		fail  bool
+	)
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	ttl := time.Minute
+	g := NewGroup("stale", 2<<10, ExpireGetterFunc(
+		func(ctx context.Context, key string) ([]byte, time.Time, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			loads++
+			if fail {
+				return nil, time.Time{}, fmt.Errorf("db down")
+			}
+			return []byte(fmt.Sprintf("v%d", loads)), clock.Now().Add(ttl), nil
+		}), WithStaleTTL(time.Hour), WithClock(clock))
+	loadCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return loads
+	}
+
+	if view, _ := g.Get("Tom"); view.String() != "v1" {
+		t.Fatalf("got %q, want v1", view.String())
+	}
+	clock.Advance(ttl + time.Second)
+
+	// 过期后立即返回旧值，并只触发一次后台刷新
+	for i := 0; i < 5; i++ {
+		if view, err := g.Get("Tom"); err != nil || view.String() != "v1" {
+			t.Fatalf("Get() = %q, %v, want stale v1", view.String(), err)
+		}
+	}
+	waitRefresh(t, g, "Tom")
+	if got := loadCount(); got != 2 {
+		t.Fatalf("loaded %d times, want 2", got)
+	}
+	if view, _ := g.Get("Tom"); view.String() != "v2" {
+		t.Fatalf("got %q after refresh, want v2", view.String())
+	}
+
+	// 刷新失败时继续返回旧值
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	clock.Advance(ttl + time.Second)
+	for i := 0; i < 2; i++ {
+		if view, err := g.Get("Tom"); err != nil || view.String() != "v2" {
+			t.Fatalf("Get() = %q, %v, want stale v2", view.String(), err)
+		}
+		waitRefresh(t, g, "Tom")
+	}
+	if got := loadCount(); got != 4 {
+		t.Fatalf("loaded %d times, want 4", got)
+	}
+	if got := g.Stats().RefreshErrs.Get(); got != 2 {
+		t.Fatalf("RefreshErrs = %d, want 2", got)
+	}
+	if got := g.Stats().StaleHits.Get(); got != 7 {
+		t.Fatalf("StaleHits = %d, want 7", got)
+	}
+	// 后台刷新不计入 Loads，Loads 仍等于 Gets - CacheHits
+	stats := g.Stats()
+	if stats.Loads.Get() != stats.Gets.Get()-stats.CacheHits.Get() || stats.Refreshes.Get() != 3 {
+		t.Fatalf("Loads = %d, Gets = %d, CacheHits = %d, Refreshes = %d",
+			stats.Loads.Get(), stats.Gets.Get(), stats.CacheHits.Get(), stats.Refreshes.Get())
+	}
+}
+
+func TestStaleTTLHardExpiry(t *testing.T) {
+	var loads int
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	ttl := time.Minute
+	g := NewGroup("stale-hard", 2<<10, ExpireGetterFunc(
+		func(ctx context.Context, key string) ([]byte, time.Time, error) {
+			loads++
+			return []byte(fmt.Sprintf("v%d", loads)), clock.Now().Add(ttl), nil
+		}), WithStaleTTL(ttl), WithClock(clock))
+
+	g.Get("Tom")
+	// 超过硬过期时间后同步加载新值
+	clock.Advance(2*ttl + time.Second)
+	if view, _ := g.Get("Tom"); view.String() != "v2" {
+		t.Fatalf("got %q, want v2 after hard expiry", view.String())
+	}
+	if got := g.Stats().StaleHits.Get(); got != 0 {
+		t.Fatalf("StaleHits = %d, want 0", got)
+	}
+}
+
+func TestEarlyRefresh(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		loads int
+	)
+	getter := ExpireGetterFunc(
+		func(ctx context.Context, key string) ([]byte, time.Time, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			loads++
+			time.Sleep(time.Millisecond)
+			return []byte(fmt.Sprintf("v%d", loads)), time.Now().Add(time.Hour), nil
+		})
+	loadCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return loads
+	}
+
+	// beta 足够大时命中必然触发提前刷新
+	g := NewGroup("early-refresh", 2<<10, getter, WithEarlyRefresh(1e12))
+	g.Get("Tom")
+	if view, err := g.Get("Tom"); err != nil || view.String() != "v1" {
+		t.Fatalf("Get() = %q, %v, want cached v1", view.String(), err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for loadCount() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := loadCount(); got != 2 {
+		t.Fatalf("loaded %d times, want 2", got)
+	}
+	if got := g.Stats().EarlyRefreshes.Get(); got != 1 {
+		t.Fatalf("EarlyRefreshes = %d, want 1", got)
+	}
+
+	// 默认关闭，离过期还远时也不会刷新
+	mu.Lock()
+	loads = 0
+	mu.Unlock()
+	for _, g := range []*Group{
+		NewGroup("early-refresh-off", 2<<10, getter),
+		NewGroup("early-refresh-far", 2<<10, getter, WithEarlyRefresh(1)),
+	} {
+		for i := 0; i < 10; i++ {
+			g.Get("Tom")
+		}
+		if got := g.Stats().EarlyRefreshes.Get(); got != 0 {
+			t.Fatalf("%s: EarlyRefreshes = %d, want 0", g.name, got)
+		}
+	}
+	if got := loadCount(); got != 2 {
+		t.Fatalf("loaded %d times, want 2", got)
+	}
+}
+
+func TestEarlyRefreshHotCache(t *testing.T) {
+	peer := &countingPeerGetter{mockPeerGetter: mockPeerGetter{
+		mockData: map[string][]byte{"Tom": []byte("630")},
+		expire:   time.Now().Add(time.Hour).UnixNano(),
+	}}
+	g := NewGroup("early-refresh-hot", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, errors.New("owned by the peer")
+		}), WithHotCacheProbability(0), WithEarlyRefresh(1e12))
+	g.RegisterPeers(&mockPeerPicker{peer: peer})
+	expire := time.Now().Add(time.Hour)
+	g.hotCache.add("Tom", ByteView{b: []byte("old"), e: expire, delta: time.Millisecond}, expire)
+
+	// 热点缓存命中触发的刷新总是写回热点缓存，即使概率为 0
+	if view, err := g.Get("Tom"); err != nil || view.String() != "old" {
+		t.Fatalf("Get() = %q, %v, want cached old", view.String(), err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if v, ok := g.hotCache.get("Tom"); ok && v.String() == "630" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("refreshed value was not written to the hot cache")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGetterPanic(t *testing.T) {
+	g := NewGroup("panic", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			panic("getter bug")
+		}))
+
+	// getter 崩溃时返回错误，之后的请求不会被卡住
+	for i := 0; i < 2; i++ {
+		var perr *singleflight.PanicError
+		_, err := g.Get("Tom")
+		if !errors.As(err, &perr) {
+			t.Fatalf("Get() error = %v, want PanicError", err)
+		}
+		// 错误会返回给其他节点和客户端，不能带上调用栈
+		if strings.Contains(err.Error(), "goroutine") {
+			t.Fatalf("Get() error leaks the stack: %v", err)
+		}
+	}
+}
+
+type replicaPeerPicker struct {
+	peers []PeerGetter
+}
+
+func (m *replicaPeerPicker) PickPeer(key string) (PeerGetter, bool) {
+	return m.peers[0], true
+}
+
+func (m *replicaPeerPicker) PickPeers(key string) []PeerGetter {
+	return m.peers
+}
+
+func TestReplicaReads(t *testing.T) {
+	var localLoads int
+	g := NewGroup("replicas", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			localLoads++
+			return []byte("origin"), nil
+		}), WithHotCacheBytes(0))
+	down := &mockPeerGetter{}
+	replica := &mockPeerGetter{mockData: map[string][]byte{"Tom": []byte("630")}}
+	g.RegisterPeers(&replicaPeerPicker{peers: []PeerGetter{down, replica}})
+
+	// 主节点失败时按顺序尝试副本
+	if view, err := g.Get("Tom"); err != nil || view.String() != "630" {
+		t.Fatalf("Get() = %q, %v, want 630 from the replica", view.String(), err)
+	}
+	stats := g.Stats()
+	if stats.PeerErrors.Get() != 1 || stats.ReplicaLoads.Get() != 1 || localLoads != 0 {
+		t.Fatalf("PeerErrors = %d, ReplicaLoads = %d, local loads = %d",
+			stats.PeerErrors.Get(), stats.ReplicaLoads.Get(), localLoads)
+	}
+
+	// 所有副本都失败后才回源
+	if view, err := g.Get("Jack"); err != nil || view.String() != "origin" {
+		t.Fatalf("Get() = %q, %v, want origin", view.String(), err)
+	}
+	if stats.PeerErrors.Get() != 3 || localLoads != 1 {
+		t.Fatalf("PeerErrors = %d, local loads = %d", stats.PeerErrors.Get(), localLoads)
+	}
+}
+
+// boundedPeerPicker 模拟有界负载：PickPeer 选中的不是第一个副本
+type boundedPeerPicker struct {
+	replicaPeerPicker
+	picked PeerGetter
+}
+
+func (m *boundedPeerPicker) PickPeer(key string) (PeerGetter, bool) {
+	return m.picked, true
+}
+
+func TestGetManyReplicas(t *testing.T) {
+	g := NewGroup("batch-replicas", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("origin"), nil
+		}), WithHotCacheBytes(0))
+	owner := &countingPeerGetter{mockPeerGetter: mockPeerGetter{mockData: map[string][]byte{"Tom": []byte("630")}}}
+	picked := &batchPeerGetter{}
+	g.RegisterPeers(&boundedPeerPicker{replicaPeerPicker{peers: []PeerGetter{owner, picked}}, picked})
+
+	// 批量请求发给了第二个副本，失败后跳过它而不是第一个副本
+	results := g.GetMany(context.Background(), []string{"Tom"})
+	if r := results[0]; r.Err != nil || r.Value.String() != "630" {
+		t.Fatalf("GetMany() = %q, %v, want 630 from the owner", r.Value.String(), r.Err)
+	}
+	if owner.calls != 1 || picked.calls != 1 {
+		t.Fatalf("owner calls = %d, batch calls = %d, want 1 and 1", owner.calls, picked.calls)
+	}
+}
+
+// flakyPeerGetter 前 failures 次请求失败，之后正常返回
+type flakyPeerGetter struct {
+	countingPeerGetter
+	failures int
+}
+
+func (m *flakyPeerGetter) Get(in *pb.GetRequest, out *pb.GetResponse) error {
+	m.mu.Lock()
+	m.calls++
+	fail := m.calls <= m.failures
+	m.mu.Unlock()
+	if fail {
+		return errors.New("connection refused")
+	}
+	return m.mockPeerGetter.Get(in, out)
+}
+
+func TestPeerFailurePolicy(t *testing.T) {
+	origin := GetterFunc(func(key string) ([]byte, error) {
+		return []byte("origin"), nil
+	})
+	data := map[string][]byte{"Tom": []byte("630")}
+
+	t.Run("retry", func(t *testing.T) {
+		peer := &flakyPeerGetter{failures: 2}
+		peer.mockData = data
+		g := NewGroup("policy-retry", 2<<10, origin, WithHotCacheBytes(0),
+			WithPeerFailurePolicy(PeerFailurePolicy{Retries: 2, Backoff: time.Millisecond}))
+		g.RegisterPeers(&mockPeerPicker{peer: peer})
+
+		// 重试两次后从 peer 取到值
+		if view, err := g.Get("Tom"); err != nil || view.String() != "630" {
+			t.Fatalf("Get() = %q, %v, want 630 from the peer", view.String(), err)
+		}
+		if peer.calls != 3 || g.Stats().PeerRetries.Get() != 2 {
+			t.Fatalf("peer calls = %d, PeerRetries = %d, want 3 and 2", peer.calls, g.Stats().PeerRetries.Get())
+		}
+	})
+
+	t.Run("owner only, fail fast", func(t *testing.T) {
+		replica := &mockPeerGetter{mockData: data}
+		g := NewGroup("policy-failfast", 2<<10, origin, WithHotCacheBytes(0),
+			WithPeerFailurePolicy(PeerFailurePolicy{OwnerOnly: true, FailFast: true}))
+		g.RegisterPeers(&replicaPeerPicker{peers: []PeerGetter{&mockPeerGetter{}, replica}})
+
+		// 不尝试副本，也不回源
+		if _, err := g.Get("Tom"); err == nil {
+			t.Fatal("Get() succeeded, want the owner's error")
+		}
+		stats := g.Stats()
+		if stats.FailFasts.Get() != 1 || stats.PeerFailovers.Get() != 0 || stats.LocalLoads.Get() != 0 {
+			t.Fatalf("FailFasts = %d, PeerFailovers = %d, LocalLoads = %d",
+				stats.FailFasts.Get(), stats.PeerFailovers.Get(), stats.LocalLoads.Get())
+		}
+	})
+
+	t.Run("next replica", func(t *testing.T) {
+		replica := &mockPeerGetter{mockData: data}
+		g := NewGroup("policy-replica", 2<<10, origin, WithHotCacheBytes(0),
+			WithPeerFailurePolicy(PeerFailurePolicy{FailFast: true}))
+		g.RegisterPeers(&replicaPeerPicker{peers: []PeerGetter{&mockPeerGetter{}, replica}})
+
+		if view, err := g.Get("Tom"); err != nil || view.String() != "630" {
+			t.Fatalf("Get() = %q, %v, want 630 from the replica", view.String(), err)
+		}
+		if g.Stats().PeerFailovers.Get() != 1 {
+			t.Fatalf("PeerFailovers = %d, want 1", g.Stats().PeerFailovers.Get())
+		}
+	})
+
+	t.Run("circuit breaker", func(t *testing.T) {
+		peer := &flakyPeerGetter{failures: 2}
+		peer.mockData = data
+		g := NewGroup("policy-breaker", 2<<10, origin, WithHotCacheBytes(0), WithNegativeTTL(0),
+			WithPeerFailurePolicy(PeerFailurePolicy{BreakAfter: 2, BreakFor: 50 * time.Millisecond}))
+		g.RegisterPeers(&mockPeerPicker{peer: peer})
+
+		// 连续失败两次后断开，之后不再请求该 peer，直接回源
+		for _, key := range []string{"a", "b", "c"} {
+			if view, err := g.Get(key); err != nil || view.String() != "origin" {
+				t.Fatalf("Get(%s) = %q, %v, want origin", key, view.String(), err)
+			}
+		}
+		stats := g.Stats()
+		if peer.calls != 2 || stats.CircuitOpens.Get() != 1 || stats.CircuitSkips.Get() != 1 {
+			t.Fatalf("peer calls = %d, CircuitOpens = %d, CircuitSkips = %d",
+				peer.calls, stats.CircuitOpens.Get(), stats.CircuitSkips.Get())
+		}
+		if stats.PeerErrors.Get() != 2 || stats.PeerFallbacks.Get() != 3 {
+			t.Fatalf("PeerErrors = %d, PeerFallbacks = %d", stats.PeerErrors.Get(), stats.PeerFallbacks.Get())
+		}
+
+		// 冷却后放行一次试探请求，成功则恢复；热点缓存关闭，每次都请求 peer
+		time.Sleep(60 * time.Millisecond)
+		for i := 0; i < 2; i++ {
+			if view, err := g.Get("Tom"); err != nil || view.String() != "630" {
+				t.Fatalf("Get() = %q, %v, want 630 from the recovered peer", view.String(), err)
+			}
+		}
+		if peer.calls != 4 {
+			t.Fatalf("peer calls = %d, want 4", peer.calls)
+		}
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	b := newCircuitBreaker(1, time.Hour)
+	if !b.allow() || !b.failure() {
+		t.Fatal("the first failure did not open a breaker with threshold 1")
+	}
+	if b.allow() || !b.open() {
+		t.Fatal("open breaker allowed a request")
+	}
+
+	// 半开状态只放行一个试探请求，失败则重新断开
+	b.openedAt = time.Now().Add(-2 * time.Hour)
+	if !b.allow() || b.allow() {
+		t.Fatal("half-open breaker must allow exactly one trial")
+	}
+	if !b.failure() || b.allow() {
+		t.Fatal("failed trial did not reopen the breaker")
+	}
+
+	// 断开期间的失败（如健康检查）重新开始冷却
+	b.openedAt = time.Now().Add(-2 * time.Hour)
+	if b.failure() || !b.open() {
+		t.Fatal("failure while open did not restart the cooldown")
+	}
+
+	b.openedAt = time.Now().Add(-2 * time.Hour)
+	b.allow()
+	if !b.success() {
+		t.Fatal("successful trial did not report closing the breaker")
+	}
+	if !b.allow() || !b.allow() {
+		t.Fatal("successful trial did not close the breaker")
+	}
+
+	var nilBreaker *circuitBreaker
+	if !nilBreaker.allow() || nilBreaker.failure() {
+		t.Fatal("nil breaker must never open")
+	}
+}
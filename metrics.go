@@ -0,0 +1,140 @@
+package distributed_cache
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// MetricsHandler returns an http.Handler that renders the statistics of
+// every group in the Prometheus text exposition format. Mount it next to
+// the pool, e.g. http.Handle("/metrics", MetricsHandler()).
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(serveMetrics)
+}
+
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	mu.RLock()
+	gs := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		gs = append(gs, g)
+	}
+	mu.RUnlock()
+	sort.Slice(gs, func(i, j int) bool { return gs[i].name < gs[j].name })
+
+	var buf bytes.Buffer
+	writeMetrics(&buf, gs)
+	w.Header().Set("Content-Type", metricsContentType)
+	w.Write(buf.Bytes())
+}
+
+type groupCounter struct {
+	name string
+	help string
+	get  func(s *Stats) int64
+}
+
+var groupCounters = []groupCounter{
+	{"gets_total", "Get requests, including from peers.", func(s *Stats) int64 { return s.Gets.Get() }},
+	{"cache_hits_total", "Get requests served from the cache.", func(s *Stats) int64 { return s.CacheHits.Get() }},
+	{"loads_total", "Cache misses that needed a load.", func(s *Stats) int64 { return s.Loads.Get() }},
+	{"loads_coalesced_total", "Loads that joined an in-flight load for the same key.", func(s *Stats) int64 { return s.Loads.Get() + s.Refreshes.Get() - s.LoadsDeduped.Get() }},
+	{"peer_loads_total", "Values fetched from peers.", func(s *Stats) int64 { return s.PeerLoads.Get() }},
+	{"peer_errors_total", "Failed fetches from peers.", func(s *Stats) int64 { return s.PeerErrors.Get() }},
+	{"replica_loads_total", "Values fetched from a replica after the owner failed.", func(s *Stats) int64 { return s.ReplicaLoads.Get() }},
+	{"peer_retries_total", "Peer fetches retried after a failure.", func(s *Stats) int64 { return s.PeerRetries.Get() }},
+	{"peer_failovers_total", "Failed peers passed over for the next replica.", func(s *Stats) int64 { return s.PeerFailovers.Get() }},
+	{"circuit_opens_total", "Peer circuits opened after repeated failures.", func(s *Stats) int64 { return s.CircuitOpens.Get() }},
+	{"circuit_skips_total", "Peer fetches skipped because the peer's circuit was open.", func(s *Stats) int64 { return s.CircuitSkips.Get() }},
+	{"peer_fallbacks_total", "Loads from the getter after no peer could serve the key.", func(s *Stats) int64 { return s.PeerFallbacks.Get() }},
+	{"fail_fasts_total", "Loads that returned a peer error instead of using the getter.", func(s *Stats) int64 { return s.FailFasts.Get() }},
+	{"local_loads_total", "Successful loads from the getter.", func(s *Stats) int64 { return s.LocalLoads.Get() }},
+	{"local_load_errors_total", "Failed loads from the getter.", func(s *Stats) int64 { return s.LocalLoadErrs.Get() }},
+	{"not_found_total", "Loads the getter answered with ErrNotFound.", func(s *Stats) int64 { return s.NotFounds.Get() }},
+	{"negative_hits_total", "Cache hits on a cached ErrNotFound.", func(s *Stats) int64 { return s.NegativeHits.Get() }},
+	{"stale_hits_total", "Cache hits served expired while refreshing.", func(s *Stats) int64 { return s.StaleHits.Get() }},
+	{"early_refreshes_total", "Cache hits that refreshed the value before it expired.", func(s *Stats) int64 { return s.EarlyRefreshes.Get() }},
+	{"refreshes_total", "Background refreshes started.", func(s *Stats) int64 { return s.Refreshes.Get() }},
+	{"refresh_errors_total", "Failed background refreshes.", func(s *Stats) int64 { return s.RefreshErrs.Get() }},
+	{"server_requests_total", "Requests received from peers.", func(s *Stats) int64 { return s.ServerRequests.Get() }},
+}
+
+type cacheMetric struct {
+	name string
+	typ  string
+	help string
+	get  func(s CacheStats) int64
+}
+
+var cacheMetrics = []cacheMetric{
+	{"cache_bytes", "gauge", "Bytes held by the cache.", func(s CacheStats) int64 { return s.Bytes }},
+	{"cache_max_bytes", "gauge", "Byte budget of the cache.", func(s CacheStats) int64 { return s.MaxBytes }},
+	{"cache_items", "gauge", "Entries held by the cache.", func(s CacheStats) int64 { return s.Items }},
+	{"cache_gets_total", "counter", "Lookups in the cache.", func(s CacheStats) int64 { return s.Gets }},
+	{"cache_hits_total", "counter", "Lookups that found an entry.", func(s CacheStats) int64 { return s.Hits }},
+	{"cache_evictions_total", "counter", "Entries evicted to stay within the byte budget.", func(s CacheStats) int64 { return s.Evictions }},
+	{"cache_expirations_total", "counter", "Entries dropped because they expired.", func(s CacheStats) int64 { return s.Expirations }},
+}
+
+// cacheTypes lists the caches reported for every group with their label.
+var cacheTypes = []struct {
+	which CacheType
+	label string
+}{
+	{MainCache, "main"},
+	{HotCache, "hot"},
+}
+
+func writeMetrics(buf *bytes.Buffer, gs []*Group) {
+	const prefix = "distributed_cache_"
+	for _, c := range groupCounters {
+		writeHeader(buf, prefix+"group_"+c.name, "counter", c.help)
+		for _, g := range gs {
+			fmt.Fprintf(buf, "%sgroup_%s{group=\"%s\"} %d\n", prefix, c.name, escapeLabel(g.name), c.get(&g.stats))
+		}
+	}
+
+	for _, m := range cacheMetrics {
+		writeHeader(buf, prefix+m.name, m.typ, m.help)
+		for _, g := range gs {
+			for _, ct := range cacheTypes {
+				fmt.Fprintf(buf, "%s%s{group=\"%s\",cache=\"%s\"} %d\n", prefix, m.name, escapeLabel(g.name), ct.label, m.get(g.CacheStats(ct.which)))
+			}
+		}
+	}
+
+	name := prefix + "peer_request_duration_seconds"
+	writeHeader(buf, name, "histogram", "Duration of requests to peers.")
+	for _, g := range gs {
+		h := &g.stats.PeerLatency
+		group := escapeLabel(g.name)
+		var cumulative int64
+		for i, bound := range latencyBuckets {
+			cumulative += h.counts[i].Get()
+			fmt.Fprintf(buf, "%s_bucket{group=\"%s\",le=\"%s\"} %d\n", name, group, formatFloat(bound.Seconds()), cumulative)
+		}
+		cumulative += h.counts[len(latencyBuckets)].Get()
+		fmt.Fprintf(buf, "%s_bucket{group=\"%s\",le=\"+Inf\"} %d\n", name, group, cumulative)
+		fmt.Fprintf(buf, "%s_sum{group=\"%s\"} %s\n", name, group, formatFloat(h.Sum().Seconds()))
+		fmt.Fprintf(buf, "%s_count{group=\"%s\"} %d\n", name, group, cumulative)
+	}
+}
+
+func writeHeader(buf *bytes.Buffer, name, typ, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,65 @@
+package distributed_cache
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	g := NewGroup("metrics\"scores", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "Tom" {
+				return []byte("630"), nil
+			}
+			return nil, fmt.Errorf("key not found")
+		}))
+	g.Get("Tom")
+	g.Get("Tom")
+	g.Get("unknown")
+	g.stats.PeerLatency.Observe(3 * time.Millisecond)
+	g.stats.PeerLatency.Observe(2 * time.Second)
+
+	server := httptest.NewServer(MetricsHandler())
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	wantLines := []string{
+		`# TYPE distributed_cache_group_gets_total counter`,
+		`distributed_cache_group_gets_total{group="metrics\"scores"} 3`,
+		`distributed_cache_group_cache_hits_total{group="metrics\"scores"} 1`,
+		`distributed_cache_group_local_load_errors_total{group="metrics\"scores"} 1`,
+		`distributed_cache_group_loads_coalesced_total{group="metrics\"scores"} 0`,
+		`# TYPE distributed_cache_cache_bytes gauge`,
+		`distributed_cache_cache_bytes{group="metrics\"scores",cache="main"} 6`,
+		`distributed_cache_cache_max_bytes{group="metrics\"scores",cache="main"} 2048`,
+		`distributed_cache_cache_max_bytes{group="metrics\"scores",cache="hot"} 0`,
+		`# TYPE distributed_cache_peer_request_duration_seconds histogram`,
+		`distributed_cache_peer_request_duration_seconds_bucket{group="metrics\"scores",le="0.001"} 0`,
+		`distributed_cache_peer_request_duration_seconds_bucket{group="metrics\"scores",le="0.005"} 1`,
+		`distributed_cache_peer_request_duration_seconds_bucket{group="metrics\"scores",le="2.5"} 2`,
+		`distributed_cache_peer_request_duration_seconds_bucket{group="metrics\"scores",le="+Inf"} 2`,
+		`distributed_cache_peer_request_duration_seconds_sum{group="metrics\"scores"} 2.003`,
+		`distributed_cache_peer_request_duration_seconds_count{group="metrics\"scores"} 2`,
+	}
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(string(body), "\n") {
+		lines[line] = true
+	}
+	for _, want := range wantLines {
+		if !lines[want] {
+			t.Errorf("missing line %s", want)
+		}
+	}
+}
@@ -1,11 +1,50 @@
 package distributed_cache
 
-import pb "distributed-cache/gen/v1"
+import (
+	"context"
+
+	pb "distributed-cache/gen/v1"
+)
 
 type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
 }
 
+// ReplicaPicker is implemented by PeerPickers that can name the replicas
+// of a key. Group tries them in order when a peer fails, before loading
+// the key itself.
+type ReplicaPicker interface {
+	// PickPeers returns the peers holding key in order of preference,
+	// stopping at this peer if it is one of them.
+	PickPeers(key string) []PeerGetter
+}
+
+// OwnerPicker is implemented by PeerPickers whose PickPeer may pass over
+// the owner of a key, e.g. to bound loads. Group sends writes to the peer
+// PickOwner returns, so that they reach the copy reads are served from.
+type OwnerPicker interface {
+	PickOwner(key string) (peer PeerGetter, ok bool)
+}
+
 type PeerGetter interface {
 	Get(in *pb.GetRequest, out *pb.GetResponse) error
 }
+
+// ContextPeerGetter is implemented by peers that can abandon an in-flight
+// fetch when ctx is done. Group prefers it over PeerGetter.Get.
+type ContextPeerGetter interface {
+	GetContext(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error
+}
+
+// PeerUpdater is implemented by peers that accept writes for the keys they
+// own.
+type PeerUpdater interface {
+	Set(ctx context.Context, in *pb.SetRequest, out *pb.SetResponse) error
+	Remove(ctx context.Context, in *pb.RemoveRequest, out *pb.RemoveResponse) error
+}
+
+// PeerBatchGetter is implemented by peers that can load several keys in one
+// round trip.
+type PeerBatchGetter interface {
+	GetMany(ctx context.Context, in *pb.GetManyRequest, out *pb.GetManyResponse) error
+}
@@ -0,0 +1,53 @@
+package placement
+
+import "sync/atomic"
+
+// Jump implements the jump consistent hash of Lamping and Veach. It needs
+// no memory beyond the node list and spreads keys evenly, but only adding
+// or removing the last bucket moves the minimum of keys: buckets are the
+// nodes in name order, so removing any other node shifts the ones after
+// it. A node of weight w takes w buckets.
+//
+// The buckets depend only on the current nodes, so peers with the same
+// nodes agree on every owner whatever changes they went through. With
+// HTTPPool.SetCircuitBreaker each opening or closing circuit is such a
+// change, so prefer another placement there.
+type Jump struct {
+	buckets atomic.Pointer[[]string]
+}
+
+func NewJump() *Jump {
+	return &Jump{}
+}
+
+func (j *Jump) Set(weights map[string]int) {
+	var buckets []string
+	for _, node := range sortedNodes(weights) {
+		for i := 0; i < weights[node]; i++ {
+			buckets = append(buckets, node)
+		}
+	}
+	j.buckets.Store(&buckets)
+}
+
+func (j *Jump) Get(key string) string {
+	b := j.buckets.Load()
+	if b == nil || len(*b) == 0 {
+		return ""
+	}
+	buckets := *b
+	return buckets[jumpHash(hash64(key), len(buckets))]
+}
+
+// jumpHash returns the bucket in [0, n) of key.
+func jumpHash(key uint64, n int) int {
+	var b, j int64 = -1, 0
+	for j < int64(n) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+var _ Placement = (*Jump)(nil)
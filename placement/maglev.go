@@ -0,0 +1,91 @@
+package placement
+
+import "sync/atomic"
+
+// DefaultMaglevTableSize is a prime well above 100 times the number of
+// nodes in a typical pool, which keeps shares within about 1% of even.
+const DefaultMaglevTableSize = 65537
+
+// Maglev implements the lookup table of Google's Maglev load balancer.
+// Get is a single table lookup and shares are close to even, at the cost
+// of rebuilding the table on Set and moving a few more keys than
+// necessary on membership changes.
+type Maglev struct {
+	size  int
+	table atomic.Pointer[[]string]
+}
+
+// NewMaglev returns a Maglev with a table of at least size entries. The
+// size is rounded up to a prime, as Set needs every node's probe sequence
+// to visit every entry. Size 0 means DefaultMaglevTableSize.
+func NewMaglev(size int) *Maglev {
+	if size <= 0 {
+		size = DefaultMaglevTableSize
+	}
+	return &Maglev{size: nextPrime(size)}
+}
+
+// nextPrime returns the smallest prime not below n.
+func nextPrime(n int) int {
+	for n = max(n, 2); ; n++ {
+		prime := true
+		for d := 2; d*d <= n; d++ {
+			if n%d == 0 {
+				prime = false
+				break
+			}
+		}
+		if prime {
+			return n
+		}
+	}
+}
+
+// Set fills a new table. Each node takes weight turns per round to claim
+// its next preferred free entry.
+func (m *Maglev) Set(weights map[string]int) {
+	nodes := sortedNodes(weights)
+	table := make([]string, m.size)
+	if len(nodes) == 0 {
+		m.table.Store(&table)
+		return
+	}
+	size := uint64(m.size)
+	offset := make([]uint64, len(nodes))
+	skip := make([]uint64, len(nodes))
+	next := make([]uint64, len(nodes))
+	for i, node := range nodes {
+		offset[i] = hash64("offset\x00"+node) % size
+		skip[i] = hash64("skip\x00"+node)%(size-1) + 1
+	}
+	filled := make([]bool, m.size)
+	for n := 0; ; {
+		for i, node := range nodes {
+			for turn := 0; turn < weights[node]; turn++ {
+				entry := (offset[i] + next[i]*skip[i]) % size
+				for filled[entry] {
+					next[i]++
+					entry = (offset[i] + next[i]*skip[i]) % size
+				}
+				table[entry] = node
+				filled[entry] = true
+				next[i]++
+				if n++; n == m.size {
+					m.table.Store(&table)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (m *Maglev) Get(key string) string {
+	t := m.table.Load()
+	if t == nil {
+		return ""
+	}
+	table := *t
+	return table[hash64(key)%uint64(len(table))]
+}
+
+var _ Placement = (*Maglev)(nil)
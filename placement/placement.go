@@ -0,0 +1,80 @@
+// Package placement provides algorithms that map keys to the nodes that
+// own them.
+package placement
+
+import (
+	"hash/fnv"
+	"sort"
+
+	"distributed-cache/consistenthash"
+)
+
+// Placement maps each key to one of a set of weighted nodes.
+// Implementations must allow Get to run concurrently with Set.
+type Placement interface {
+	// Set replaces the nodes. A node's share of the keys is proportional
+	// to its weight; nodes with a weight of 0 or less are left out. Set
+	// does not keep weights.
+	Set(weights map[string]int)
+	// Get returns the node that owns key, or "" if there are no nodes.
+	Get(key string) string
+}
+
+// BoundedLoad is implemented by placements that can move a key off its
+// owner while the owner has too many requests in flight.
+type BoundedLoad interface {
+	// GetWithLoad is like Get, but skips nodes with more than c times their
+	// share of the requests in flight, as reported by load.
+	GetWithLoad(key string, c float64, load func(node string) int64) string
+}
+
+// Replicas is implemented by placements that can name several nodes for a
+// key, to read from when its owner is down.
+type Replicas interface {
+	// GetN returns up to n distinct nodes for key in order of preference,
+	// starting with the node Get returns.
+	GetN(key string, n int) []string
+}
+
+// NewRing returns the consistent hash ring of package consistenthash,
+// with replicas virtual nodes per unit of weight.
+func NewRing(replicas int, fn consistenthash.Hash) *consistenthash.Map {
+	return consistenthash.New(replicas, fn)
+}
+
+var (
+	_ Placement   = (*consistenthash.Map)(nil)
+	_ BoundedLoad = (*consistenthash.Map)(nil)
+	_ Replicas    = (*consistenthash.Map)(nil)
+)
+
+// hash64 hashes s with FNV-1a and spreads the result with the splitmix64
+// finalizer, as FNV alone mixes short inputs poorly.
+func hash64(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return mix64(h.Sum64())
+}
+
+// mix64 is the splitmix64 finalizer.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// sortedNodes returns the nodes with a positive weight, sorted by name so
+// that every peer builds the same tables.
+func sortedNodes(weights map[string]int) []string {
+	nodes := make([]string, 0, len(weights))
+	for node, weight := range weights {
+		if weight > 0 {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Strings(nodes)
+	return nodes
+}
@@ -0,0 +1,229 @@
+package placement
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+var placements = []struct {
+	name string
+	new  func() Placement
+}{
+	{"ring", func() Placement { return NewRing(100, nil) }},
+	{"jump", func() Placement { return NewJump() }},
+	{"rendezvous", func() Placement { return NewRendezvous() }},
+	{"maglev", func() Placement { return NewMaglev(0) }},
+}
+
+func nodeWeights(n int) map[string]int {
+	weights := make(map[string]int, n)
+	for i := 0; i < n; i++ {
+		weights[fmt.Sprintf("http://10.0.0.%d:8000", i)] = 1
+	}
+	return weights
+}
+
+func owners(p Placement, keys int) map[string]string {
+	owner := make(map[string]string, keys)
+	for i := 0; i < keys; i++ {
+		key := "key-" + strconv.Itoa(i)
+		owner[key] = p.Get(key)
+	}
+	return owner
+}
+
+// remapped returns the fraction of keys whose owner differs.
+func remapped(before, after map[string]string) float64 {
+	moved := 0
+	for key, node := range before {
+		if after[key] != node {
+			moved++
+		}
+	}
+	return float64(moved) / float64(len(before))
+}
+
+func TestPlacement(t *testing.T) {
+	for _, tt := range placements {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.new()
+			if got := p.Get("Tom"); got != "" {
+				t.Fatalf("empty placement returned %q", got)
+			}
+
+			// 相同的节点集合在不同实例上给出相同的结果
+			weights := map[string]int{"a": 1, "b": 2, "c": 1, "d": 0}
+			p.Set(weights)
+			q := tt.new()
+			q.Set(map[string]int{"c": 1, "b": 2, "a": 1})
+			counts := make(map[string]int)
+			const n = 40000
+			for i := 0; i < n; i++ {
+				key := "key-" + strconv.Itoa(i)
+				node := p.Get(key)
+				if node != q.Get(key) {
+					t.Fatalf("placements with the same nodes disagree on %s", key)
+				}
+				counts[node]++
+			}
+
+			// 分布与权重成正比，权重为 0 的节点不分配 key
+			if counts["d"] != 0 {
+				t.Fatalf("node with weight 0 got %d keys", counts["d"])
+			}
+			for node, share := range map[string]float64{"a": 0.25, "b": 0.5, "c": 0.25} {
+				if got := float64(counts[node]) / n; got < share*0.8 || got > share*1.2 {
+					t.Errorf("node %s got %.3f of the keys, want about %.2f", node, got, share)
+				}
+			}
+
+			p.Set(nil)
+			if got := p.Get("Tom"); got != "" {
+				t.Fatalf("placement without nodes returned %q", got)
+			}
+		})
+	}
+}
+
+func TestPlacementRemove(t *testing.T) {
+	for _, tt := range placements {
+		if tt.name == "jump" {
+			// removing a bucket other than the last shifts the rest
+			continue
+		}
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.new()
+			weights := nodeWeights(10)
+			p.Set(weights)
+			before := owners(p, 10000)
+
+			removed := "http://10.0.0.3:8000"
+			delete(weights, removed)
+			p.Set(weights)
+			after := owners(p, 10000)
+
+			// 大部分 key 只有原本属于被移除节点时才迁移
+			moved, stray := 0, 0
+			for key, node := range before {
+				if after[key] == node {
+					continue
+				}
+				moved++
+				if node != removed {
+					stray++
+				}
+			}
+			if moved == 0 || float64(stray) > 0.02*float64(len(before)) {
+				t.Fatalf("%d keys moved, %d of them not owned by the removed node", moved, stray)
+			}
+		})
+	}
+}
+
+func TestReplicas(t *testing.T) {
+	for _, tt := range placements {
+		r, ok := tt.new().(Replicas)
+		if !ok {
+			continue
+		}
+		t.Run(tt.name, func(t *testing.T) {
+			p := r.(Placement)
+			p.Set(nodeWeights(5))
+			for i := 0; i < 100; i++ {
+				key := "key-" + strconv.Itoa(i)
+				nodes := r.GetN(key, 3)
+				if len(nodes) != 3 || nodes[0] != p.Get(key) {
+					t.Fatalf("GetN(%s, 3) = %v, want 3 nodes starting with %s", key, nodes, p.Get(key))
+				}
+				if nodes[0] == nodes[1] || nodes[1] == nodes[2] || nodes[0] == nodes[2] {
+					t.Fatalf("GetN(%s, 3) = %v, want distinct nodes", key, nodes)
+				}
+			}
+			if got := r.GetN("Tom", 10); len(got) != 5 {
+				t.Fatalf("GetN with n above the node count returned %v", got)
+			}
+		})
+	}
+}
+
+func TestJumpDeterministic(t *testing.T) {
+	// 桶只由当前节点决定，与成员变化的历史无关
+	weights := nodeWeights(10)
+	p := NewJump()
+	p.Set(weights)
+	delete(weights, "http://10.0.0.3:8000")
+	delete(weights, "http://10.0.0.5:8000")
+	p.Set(weights)
+	weights["http://10.0.0.5:8000"] = 1
+	p.Set(weights)
+	weights["http://10.0.0.3:8000"] = 1
+	p.Set(weights)
+
+	fresh := NewJump()
+	fresh.Set(nodeWeights(10))
+	if moved := remapped(owners(p, 10000), owners(fresh, 10000)); moved != 0 {
+		t.Fatalf("%.3f of the keys differ from a fresh placement", moved)
+	}
+}
+
+func TestMaglevSize(t *testing.T) {
+	for size, want := range map[int]int{1: 2, 7: 7, 100: 101, 65536: DefaultMaglevTableSize} {
+		if got := NewMaglev(size).size; got != want {
+			t.Errorf("NewMaglev(%d) has %d entries, want %d", size, got, want)
+		}
+	}
+
+	// 非素数的大小曾导致填表死循环
+	m := NewMaglev(100)
+	m.Set(nodeWeights(5))
+	if m.Get("Tom") == "" {
+		t.Fatal("Maglev with 5 nodes returned no node")
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	for _, tt := range placements {
+		for _, n := range []int{10, 100} {
+			b.Run(fmt.Sprintf("%s/%d", tt.name, n), func(b *testing.B) {
+				p := tt.new()
+				p.Set(nodeWeights(n))
+				keys := make([]string, 1024)
+				for i := range keys {
+					keys[i] = "key-" + strconv.Itoa(i)
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					p.Get(keys[i%len(keys)])
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkRemap reports the fraction of keys that move when a node joins
+// or leaves a pool of 10; the minimum is 1/11 and 1/10.
+func BenchmarkRemap(b *testing.B) {
+	for _, tt := range placements {
+		b.Run(tt.name, func(b *testing.B) {
+			var join, leave float64
+			for i := 0; i < b.N; i++ {
+				p := tt.new()
+				weights := nodeWeights(10)
+				p.Set(weights)
+				before := owners(p, 10000)
+
+				weights["http://10.0.0.10:8000"] = 1
+				p.Set(weights)
+				join = remapped(before, owners(p, 10000))
+
+				delete(weights, "http://10.0.0.10:8000")
+				delete(weights, "http://10.0.0.3:8000")
+				p.Set(weights)
+				leave = remapped(before, owners(p, 10000))
+			}
+			b.ReportMetric(join, "join-remapped")
+			b.ReportMetric(leave, "leave-remapped")
+		})
+	}
+}
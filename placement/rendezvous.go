@@ -0,0 +1,77 @@
+package placement
+
+import (
+	"math"
+	"sort"
+	"sync/atomic"
+)
+
+// Rendezvous implements highest random weight hashing: a key belongs to
+// the node that scores highest for it. Only the keys of an added or
+// removed node move, but Get costs time linear in the number of nodes.
+// Weights use the logarithmic method, so shares are exactly proportional.
+type Rendezvous struct {
+	nodes atomic.Pointer[[]weightedNode]
+}
+
+type weightedNode struct {
+	name   string
+	weight float64
+}
+
+func NewRendezvous() *Rendezvous {
+	return &Rendezvous{}
+}
+
+func (r *Rendezvous) Set(weights map[string]int) {
+	var nodes []weightedNode
+	for _, node := range sortedNodes(weights) {
+		nodes = append(nodes, weightedNode{node, float64(weights[node])})
+	}
+	r.nodes.Store(&nodes)
+}
+
+func (r *Rendezvous) Get(key string) string {
+	n := r.nodes.Load()
+	if n == nil {
+		return ""
+	}
+	best, bestScore := "", math.Inf(-1)
+	for _, node := range *n {
+		if score := node.score(key); score > bestScore {
+			best, bestScore = node.name, score
+		}
+	}
+	return best
+}
+
+// GetN returns the n nodes that score highest for key, best first.
+func (r *Rendezvous) GetN(key string, n int) []string {
+	nodes := r.nodes.Load()
+	if nodes == nil || n <= 0 {
+		return nil
+	}
+	scores := make([]float64, len(*nodes))
+	order := make([]int, len(*nodes))
+	for i, node := range *nodes {
+		scores[i], order[i] = node.score(key), i
+	}
+	sort.Slice(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	names := make([]string, min(n, len(order)))
+	for j := range names {
+		names[j] = (*nodes)[order[j]].name
+	}
+	return names
+}
+
+// score maps the hash of node and key into (0, 1) and turns it into an
+// exponential draw scaled by the weight, -w/ln(u).
+func (node weightedNode) score(key string) float64 {
+	u := (float64(hash64(node.name+"\x00"+key)>>11) + 0.5) / (1 << 53)
+	return -node.weight / math.Log(u)
+}
+
+var (
+	_ Placement = (*Rendezvous)(nil)
+	_ Replicas  = (*Rendezvous)(nil)
+)
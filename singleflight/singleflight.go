@@ -1,11 +1,44 @@
 package singleflight
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// ErrGoexit is returned to the callers sharing a call whose fn called
+// runtime.Goexit.
+var ErrGoexit = errors.New("singleflight: fn called runtime.Goexit")
+
+// PanicError is returned to the callers sharing a call whose fn panicked.
+// Error leaves out the stack, which callers may pass on to clients.
+type PanicError struct {
+	Value interface{} // the value passed to panic
+	Stack []byte      // the stack of the panicking goroutine
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("singleflight: fn panicked: %v", p.Value)
+}
 
 type call struct {
 	wg  sync.WaitGroup
 	val interface{}
 	err error
+
+	// dups counts the callers that joined the call; chans are the DoChan
+	// callers waiting for it
+	dups  int
+	chans []chan<- Result
+}
+
+// Result holds the results of Do, so they can be passed on a channel.
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool // whether Val was given to more than one caller
 }
 
 type Group struct {
@@ -19,6 +52,7 @@ func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, err
 		g.m = make(map[string]*call)
 	}
 	if c, ok := g.m[key]; ok {
+		c.dups++
 		g.mu.Unlock()
 		c.wg.Wait()
 		return c.val, c.err
@@ -28,12 +62,83 @@ func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, err
 	g.m[key] = c
 	g.mu.Unlock()
 
-	c.val, c.err = fn()
-	c.wg.Done()
+	g.doCall(c, key, fn)
+	return c.val, c.err
+}
+
+// DoChan is like Do but returns a channel that receives the result when
+// it is ready. The channel is buffered, so the caller may stop waiting.
+func (g *Group) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		c.chans = append(c.chans, ch)
+		g.mu.Unlock()
+		return ch
+	}
+	c := &call{chans: []chan<- Result{ch}}
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	go g.doCall(c, key, fn)
+	return ch
+}
 
+// DoContext is like Do but returns ctx.Err() as soon as ctx is done. The
+// call keeps running for the other callers sharing it.
+func (g *Group) DoContext(ctx context.Context, key string, fn func() (interface{}, error)) (interface{}, error) {
+	select {
+	case r := <-g.DoChan(key, fn):
+		return r.Val, r.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Forget makes the next call for key run fn rather than wait for the call
+// in flight, e.g. when that one is stuck.
+func (g *Group) Forget(key string) {
 	g.mu.Lock()
 	delete(g.m, key)
 	g.mu.Unlock()
+}
 
-	return c.val, c.err
+// doCall runs fn for c. Waiters are released even if fn panics or calls
+// runtime.Goexit, so the key never stays stuck.
+func (g *Group) doCall(c *call, key string, fn func() (interface{}, error)) {
+	normalReturn := false
+	defer func() {
+		// neither returned nor panicked: fn called runtime.Goexit
+		if !normalReturn && c.err == nil {
+			c.val, c.err = nil, ErrGoexit
+		}
+		g.finish(c, key)
+	}()
+	defer func() {
+		if !normalReturn {
+			if r := recover(); r != nil {
+				c.val, c.err = nil, &PanicError{Value: r, Stack: debug.Stack()}
+			}
+		}
+	}()
+	c.val, c.err = fn()
+	normalReturn = true
+}
+
+func (g *Group) finish(c *call, key string) {
+	g.mu.Lock()
+	c.wg.Done()
+	// after Forget the key may belong to a newer call
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
+	for _, ch := range c.chans {
+		ch <- Result{c.val, c.err, c.dups > 0}
+	}
+	g.mu.Unlock()
 }
@@ -0,0 +1,253 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	var g Group
+	v, err := g.Do("key", func() (interface{}, error) {
+		return "bar", nil
+	})
+	if v != "bar" || err != nil {
+		t.Fatalf("Do = %v, %v", v, err)
+	}
+
+	someErr := errors.New("some error")
+	if _, err := g.Do("key", func() (interface{}, error) {
+		return nil, someErr
+	}); err != someErr {
+		t.Fatalf("Do error = %v; want %v", err, someErr)
+	}
+}
+
+func TestDoDupSuppress(t *testing.T) {
+	var g Group
+	var calls int32
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "bar", nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := g.Do("key", fn); v != "bar" || err != nil {
+				t.Errorf("Do = %v, %v", v, err)
+			}
+		}()
+	}
+	// 等待所有调用者加入同一次调用
+	waitDups(&g, "key", n-1)
+	close(release)
+	wg.Wait()
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("fn called %d times; want 1", got)
+	}
+}
+
+func TestDoChan(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		return "bar", nil
+	}
+	ch1 := g.DoChan("key", fn)
+	ch2 := g.DoChan("key", fn)
+	close(release)
+	for _, ch := range []<-chan Result{ch1, ch2} {
+		r := <-ch
+		if r.Val != "bar" || r.Err != nil || !r.Shared {
+			t.Fatalf("DoChan = %+v", r)
+		}
+	}
+
+	r := <-g.DoChan("key", func() (interface{}, error) {
+		return "baz", nil
+	})
+	if r.Val != "baz" || r.Shared {
+		t.Fatalf("DoChan = %+v; want unshared baz", r)
+	}
+}
+
+func TestDoContext(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		return "bar", nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := g.DoContext(ctx, "key", fn)
+		errc <- err
+	}()
+	waitCall(&g, "key")
+
+	done := make(chan Result, 1)
+	go func() {
+		v, err := g.DoContext(context.Background(), "key", fn)
+		done <- Result{Val: v, Err: err}
+	}()
+	waitDups(&g, "key", 1)
+
+	// 取消的调用者提前返回，不影响其他调用者
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("DoContext error = %v; want %v", err, context.Canceled)
+	}
+	close(release)
+	if r := <-done; r.Val != "bar" || r.Err != nil {
+		t.Fatalf("DoContext = %v, %v", r.Val, r.Err)
+	}
+}
+
+func TestForget(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	first := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+	waitCall(&g, "key")
+
+	// Forget 之后的调用不再等待卡住的调用
+	g.Forget("key")
+	v, _ := g.Do("key", func() (interface{}, error) {
+		return 2, nil
+	})
+	if v != 2 {
+		t.Fatalf("Do after Forget = %v; want 2", v)
+	}
+
+	second := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return 3, nil
+	})
+	close(release)
+	if r := <-first; r.Val != 1 {
+		t.Fatalf("forgotten call = %v; want 1", r.Val)
+	}
+	if r := <-second; r.Val != 3 {
+		t.Fatalf("new call = %v; want 3", r.Val)
+	}
+}
+
+func TestDoPanic(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		panic("boom")
+	}
+
+	const n = 5
+	errs := make(chan error, n+1)
+	for i := 0; i < n; i++ {
+		go func() {
+			_, err := g.Do("key", fn)
+			errs <- err
+		}()
+	}
+	ch := g.DoChan("key", fn)
+	waitDups(&g, "key", n)
+	close(release)
+
+	// 所有等待者都收到 PanicError，而不是永久阻塞
+	for i := 0; i < n; i++ {
+		var perr *PanicError
+		if err := <-errs; !errors.As(err, &perr) || perr.Value != "boom" {
+			t.Fatalf("Do error = %v; want PanicError", err)
+		}
+		// 错误信息不含调用栈，调用栈单独保存
+		if msg := perr.Error(); msg != "singleflight: fn panicked: boom" || len(perr.Stack) == 0 {
+			t.Fatalf("Error() = %q with %d bytes of stack", msg, len(perr.Stack))
+		}
+	}
+	select {
+	case r := <-ch:
+		if _, ok := r.Err.(*PanicError); !ok {
+			t.Fatalf("DoChan error = %v; want PanicError", r.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("DoChan waiter blocked after panic")
+	}
+
+	// key 不会泄漏，之后的调用正常执行
+	if v, err := g.Do("key", func() (interface{}, error) { return "bar", nil }); v != "bar" || err != nil {
+		t.Fatalf("Do after panic = %v, %v", v, err)
+	}
+}
+
+func TestDoGoexit(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	returned := make(chan bool, 1)
+	go func() {
+		g.Do("key", func() (interface{}, error) {
+			<-release
+			runtime.Goexit()
+			return nil, nil
+		})
+		returned <- true
+	}()
+	waitCall(&g, "key")
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := g.Do("key", func() (interface{}, error) { return "bar", nil })
+		errc <- err
+	}()
+	waitDups(&g, "key", 1)
+	close(release)
+
+	select {
+	case err := <-errc:
+		if err != ErrGoexit {
+			t.Fatalf("Do error = %v; want %v", err, ErrGoexit)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("waiter blocked after Goexit")
+	}
+	select {
+	case <-returned:
+		t.Fatalf("Do returned in the goroutine that called Goexit")
+	default:
+	}
+
+	if v, err := g.Do("key", func() (interface{}, error) { return "bar", nil }); v != "bar" || err != nil {
+		t.Fatalf("Do after Goexit = %v, %v", v, err)
+	}
+}
+
+// waitCall waits until a call for key is in flight.
+func waitCall(g *Group, key string) {
+	waitDups(g, key, 0)
+}
+
+// waitDups waits until n callers have joined the call for key.
+func waitDups(g *Group, key string, n int) {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		g.mu.Lock()
+		c, ok := g.m[key]
+		ok = ok && c.dups >= n
+		g.mu.Unlock()
+		if ok {
+			return
+		}
+	}
+}
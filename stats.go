@@ -0,0 +1,122 @@
+package distributed_cache
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// An AtomicInt is an int64 to be accessed atomically.
+type AtomicInt int64
+
+// Add atomically adds n to i.
+func (i *AtomicInt) Add(n int64) {
+	atomic.AddInt64((*int64)(i), n)
+}
+
+// Get atomically gets the value of i.
+func (i *AtomicInt) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+func (i *AtomicInt) String() string {
+	return strconv.FormatInt(i.Get(), 10)
+}
+
+// Stats are per-group statistics.
+type Stats struct {
+	Gets           AtomicInt // any Get request, including from peers
+	CacheHits      AtomicInt // served from the cache
+	Loads          AtomicInt // cache misses (Gets - CacheHits)
+	LoadsDeduped   AtomicInt // loads actually run; Loads + Refreshes - LoadsDeduped were coalesced by singleflight
+	PeerLoads      AtomicInt // values fetched from a peer
+	PeerErrors     AtomicInt // failed peer fetches
+	ReplicaLoads   AtomicInt // values fetched from a replica after the owner failed
+	PeerRetries    AtomicInt // peer fetches retried after a failure
+	PeerFailovers  AtomicInt // failed peers passed over for the next replica
+	CircuitOpens   AtomicInt // peer circuits opened after repeated failures
+	CircuitSkips   AtomicInt // peer fetches skipped because the peer's circuit was open
+	PeerFallbacks  AtomicInt // loads from the getter after no peer could serve the key
+	FailFasts      AtomicInt // loads that returned a peer error instead of using the getter
+	LocalLoads     AtomicInt // successful loads from the getter
+	LocalLoadErrs  AtomicInt // failed loads from the getter
+	NotFounds      AtomicInt // loads the getter answered with ErrNotFound
+	NegativeHits   AtomicInt // cache hits on a cached ErrNotFound
+	StaleHits      AtomicInt // cache hits served expired while refreshing
+	EarlyRefreshes AtomicInt // cache hits that refreshed the value before it expired
+	Refreshes      AtomicInt // background refreshes started
+	RefreshErrs    AtomicInt // failed background refreshes
+	ServerRequests AtomicInt // gets that came over the network from peers
+
+	PeerLatency LatencyHistogram // duration of requests to peers
+}
+
+// latencyBuckets are the upper bounds of the LatencyHistogram buckets.
+var latencyBuckets = [...]time.Duration{
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// A LatencyHistogram counts durations into fixed buckets. The zero value is
+// ready to use.
+type LatencyHistogram struct {
+	// counts[i] holds observations in (latencyBuckets[i-1], latencyBuckets[i]];
+	// the last one holds those above every bound.
+	counts [len(latencyBuckets) + 1]AtomicInt
+	sum    AtomicInt // nanoseconds
+}
+
+// Observe records one duration.
+func (h *LatencyHistogram) Observe(d time.Duration) {
+	i := 0
+	for i < len(latencyBuckets) && d > latencyBuckets[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.sum.Add(int64(d))
+}
+
+// Count returns the number of recorded durations.
+func (h *LatencyHistogram) Count() int64 {
+	var n int64
+	for i := range h.counts {
+		n += h.counts[i].Get()
+	}
+	return n
+}
+
+// Sum returns the total of recorded durations.
+func (h *LatencyHistogram) Sum() time.Duration {
+	return time.Duration(h.sum.Get())
+}
+
+// CacheType selects one of a group's caches.
+type CacheType int
+
+const (
+	// MainCache holds the keys this node owns.
+	MainCache CacheType = iota + 1
+	// HotCache holds copies of popular keys owned by peers.
+	HotCache
+)
+
+// CacheStats are returned by stats accessors on Group and Cache.
+type CacheStats struct {
+	Bytes       int64
+	MaxBytes    int64
+	Items       int64
+	Gets        int64
+	Hits        int64
+	Evictions   int64 // entries dropped to stay within maxBytes
+	Expirations int64 // entries dropped because they expired
+}
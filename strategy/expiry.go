@@ -0,0 +1,129 @@
+package strategy
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Clock tells strategies the current time; tests inject a fake one.
+// Strategies without a Clock use time.Now.
+type Clock interface {
+	Now() time.Time
+}
+
+type expiryItem struct {
+	key    string
+	expire time.Time
+	index  int
+}
+
+type expiryHeap []*expiryItem
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expire.Before(h[j].expire) }
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	item := x.(*expiryItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// ExpiryQueue is a min-heap of keys ordered by expiry time, letting a
+// strategy find expired entries without scanning all of them. Keys that
+// never expire are not tracked. The zero value is ready to use.
+type ExpiryQueue struct {
+	h     expiryHeap
+	items map[string]*expiryItem
+}
+
+// Set records that key expires at expire. A zero expire stops tracking key.
+func (q *ExpiryQueue) Set(key string, expire time.Time) {
+	if expire.IsZero() {
+		q.Remove(key)
+		return
+	}
+	if q.items == nil {
+		q.items = make(map[string]*expiryItem)
+	}
+	if item, ok := q.items[key]; ok {
+		item.expire = expire
+		heap.Fix(&q.h, item.index)
+		return
+	}
+	item := &expiryItem{key: key, expire: expire}
+	heap.Push(&q.h, item)
+	q.items[key] = item
+}
+
+// Remove stops tracking key.
+func (q *ExpiryQueue) Remove(key string) {
+	if item, ok := q.items[key]; ok {
+		heap.Remove(&q.h, item.index)
+		delete(q.items, key)
+	}
+}
+
+// Expired returns the key that expired earliest, if it expired before now.
+func (q *ExpiryQueue) Expired(now time.Time) (key string, ok bool) {
+	if len(q.h) == 0 || !q.h[0].expire.Before(now) {
+		return "", false
+	}
+	return q.h[0].key, true
+}
+
+// Len returns the number of tracked keys.
+func (q *ExpiryQueue) Len() int {
+	return len(q.h)
+}
+
+// Janitor calls a sweep function periodically until stopped.
+type Janitor struct {
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// StartJanitor calls sweep every interval in a new goroutine.
+func StartJanitor(interval time.Duration, sweep func()) *Janitor {
+	j := &Janitor{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(j.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sweep()
+			case <-j.stop:
+				return
+			}
+		}
+	}()
+	return j
+}
+
+// Stop ends the janitor and waits for an in-progress sweep to finish.
+func (j *Janitor) Stop() {
+	j.once.Do(func() {
+		close(j.stop)
+	})
+	<-j.done
+}
@@ -12,6 +12,8 @@ type LFU struct {
 	frequency map[int]*list.List
 	remover   strategy.EntryRemover
 	OnEvicted func(key string, value strategy.Value)
+	clock     strategy.Clock
+	expiry    strategy.ExpiryQueue
 }
 
 type entry struct {
@@ -29,13 +31,22 @@ func WithOnEvicted(onEvicted func(string, strategy.Value)) Option {
 	}
 }
 
+// WithClock sets the clock used to decide whether entries have expired.
+func WithClock(clock strategy.Clock) Option {
+	return func(lfu *LFU) {
+		lfu.clock = clock
+	}
+}
+
 func New(opts ...Option) *LFU {
 	l := &LFU{
 		cache:     make(map[string]*list.Element),
 		frequency: make(map[int]*list.List),
 	}
 	for _, opt := range opts {
-		opt(l)
+		if opt != nil {
+			opt(l)
+		}
 	}
 	return l
 }
@@ -43,10 +54,11 @@ func New(opts ...Option) *LFU {
 func (l *LFU) Get(key string) (value strategy.Value, ok bool) {
 	if ele, ok := l.cache[key]; ok {
 		kv := ele.Value.(*entry)
-		l.removeElement(ele)
-		if !kv.expire.IsZero() && kv.expire.Before(time.Now()) {
+		if !kv.expire.IsZero() && kv.expire.Before(l.now()) {
+			l.removeEntry(ele)
 			return nil, false
 		}
+		l.removeElement(ele)
 		kv.freq++
 		e := l.addElement(kv)
 		l.cache[key] = e
@@ -63,10 +75,15 @@ func (l *LFU) Add(key string, value strategy.Value, expire time.Time) {
 	}
 	if ele, ok := l.cache[key]; ok {
 		kv := ele.Value.(*entry)
+		// the replaced value no longer occupies the cache
+		if l.remover != nil {
+			l.remover.OnEntryRemoved(kv.key, kv.value)
+		}
 		kv.value = value
 		kv.expire = expire
 		l.removeElement(ele)
 		kv.freq++
+		l.cache[key] = l.addElement(kv)
 	} else {
 		e := l.addElement(&entry{
 			freq:   1,
@@ -76,6 +93,7 @@ func (l *LFU) Add(key string, value strategy.Value, expire time.Time) {
 		})
 		l.cache[key] = e
 	}
+	l.expiry.Set(key, expire)
 }
 
 func (l *LFU) RemoveOldest() {
@@ -89,17 +107,27 @@ func (l *LFU) RemoveOldest() {
 	if minFreq != -1 {
 		ll := l.frequency[minFreq]
 		if ll != nil && ll.Len() > 0 {
-			ele := ll.Back()
-			l.removeElement(ele)
-			kv := ele.Value.(*entry)
-			delete(l.cache, kv.key)
-			if l.remover != nil {
-				l.remover.OnEntryRemoved(kv.key, kv.value)
-			}
-			if l.OnEvicted != nil {
-				l.OnEvicted(kv.key, kv.value)
-			}
+			l.removeEntry(ll.Back())
+		}
+	}
+}
+
+func (l *LFU) RemoveExpired() int {
+	now := l.now()
+	n := 0
+	for {
+		key, ok := l.expiry.Expired(now)
+		if !ok {
+			return n
 		}
+		l.removeEntry(l.cache[key])
+		n++
+	}
+}
+
+func (l *LFU) Remove(key string) {
+	if ele, ok := l.cache[key]; ok {
+		l.removeEntry(ele)
 	}
 }
 
@@ -115,9 +143,30 @@ func (l *LFU) removeElement(ele *list.Element) {
 	}
 }
 
+// removeEntry drops the entry from the cache and notifies the listeners.
+func (l *LFU) removeEntry(ele *list.Element) {
+	l.removeElement(ele)
+	kv := ele.Value.(*entry)
+	delete(l.cache, kv.key)
+	l.expiry.Remove(kv.key)
+	if l.remover != nil {
+		l.remover.OnEntryRemoved(kv.key, kv.value)
+	}
+	if l.OnEvicted != nil {
+		l.OnEvicted(kv.key, kv.value)
+	}
+}
+
 func (l *LFU) addElement(kv *entry) *list.Element {
 	if l.frequency[kv.freq] == nil {
 		l.frequency[kv.freq] = list.New()
 	}
 	return l.frequency[kv.freq].PushFront(kv)
 }
+
+func (l *LFU) now() time.Time {
+	if l.clock == nil {
+		return time.Now()
+	}
+	return l.clock.Now()
+}
@@ -3,6 +3,8 @@ package lfu
 import (
 	"testing"
 	"time"
+
+	"distributed-cache/strategy"
 )
 
 type value struct {
@@ -23,3 +25,45 @@ func TestLFU_Basic(t *testing.T) {
 		t.Fatalf("lfu miss key2 failed")
 	}
 }
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestLFU_RemoveExpired(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	var evicted []string
+	lfu := New(WithClock(clock), WithOnEvicted(func(key string, _ strategy.Value) {
+		evicted = append(evicted, key)
+	}))
+	lfu.Add("key1", &value{"value1"}, clock.now.Add(time.Second))
+	lfu.Add("key2", &value{"value2"}, clock.now.Add(time.Minute))
+	lfu.Add("key3", &value{"value3"}, time.Time{})
+
+	if n := lfu.RemoveExpired(); n != 0 {
+		t.Fatalf("nothing should expire yet, removed %d", n)
+	}
+
+	clock.now = clock.now.Add(2 * time.Second)
+	if n := lfu.RemoveExpired(); n != 1 || len(evicted) != 1 || evicted[0] != "key1" {
+		t.Fatalf("expect key1 removed, got %d removed, evicted %v", n, evicted)
+	}
+	if _, ok := lfu.Get("key1"); ok {
+		t.Fatalf("key1 should be gone")
+	}
+	if _, ok := lfu.Get("key2"); !ok {
+		t.Fatalf("key2 should still exist")
+	}
+
+	clock.now = clock.now.Add(time.Hour)
+	if n := lfu.RemoveExpired(); n != 1 {
+		t.Fatalf("expect key2 removed, got %d", n)
+	}
+	if _, ok := lfu.Get("key3"); !ok {
+		t.Fatalf("key3 never expires")
+	}
+}
@@ -12,6 +12,8 @@ type LRU struct {
 	cache     map[string]*list.Element
 	OnEvicted func(key string, value strategy.Value)
 	remover   strategy.EntryRemover
+	clock     strategy.Clock
+	expiry    strategy.ExpiryQueue
 }
 
 type entry struct {
@@ -28,13 +30,22 @@ func WithOnEvicted(onEvicted func(string, strategy.Value)) Option {
 	}
 }
 
+// WithClock sets the clock used to decide whether entries have expired.
+func WithClock(clock strategy.Clock) Option {
+	return func(lru *LRU) {
+		lru.clock = clock
+	}
+}
+
 func New(option ...Option) *LRU {
 	l := &LRU{
 		ll:    list.New(),
 		cache: make(map[string]*list.Element),
 	}
 	for _, opt := range option {
-		opt(l)
+		if opt != nil {
+			opt(l)
+		}
 	}
 	return l
 }
@@ -47,7 +58,7 @@ func (c *LRU) Get(key string) (value strategy.Value, ok bool) {
 	if ele, ok := c.cache[key]; ok {
 		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
-		if !kv.expire.IsZero() && kv.expire.Before(time.Now()) {
+		if !kv.expire.IsZero() && kv.expire.Before(c.now()) {
 			c.removeElement(ele)
 			return nil, false
 		}
@@ -59,15 +70,20 @@ func (c *LRU) Get(key string) (value strategy.Value, ok bool) {
 func (c *LRU) RemoveOldest() {
 	ele := c.ll.Back()
 	if ele != nil {
-		c.ll.Remove(ele)
-		kv := ele.Value.(*entry)
-		delete(c.cache, kv.key)
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
-		}
-		if c.remover != nil {
-			c.remover.OnEntryRemoved(kv.key, kv.value)
+		c.removeElement(ele)
+	}
+}
+
+func (c *LRU) RemoveExpired() int {
+	now := c.now()
+	n := 0
+	for {
+		key, ok := c.expiry.Expired(now)
+		if !ok {
+			return n
 		}
+		c.removeElement(c.cache[key])
+		n++
 	}
 }
 
@@ -79,12 +95,23 @@ func (c *LRU) Add(key string, value strategy.Value, expire time.Time) {
 	if ele, ok := c.cache[key]; ok {
 		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
+		// the replaced value no longer occupies the cache
+		if c.remover != nil {
+			c.remover.OnEntryRemoved(kv.key, kv.value)
+		}
 		kv.value = value
 		kv.expire = expire
 	} else {
 		ele := c.ll.PushFront(&entry{key, value, expire})
 		c.cache[key] = ele
 	}
+	c.expiry.Set(key, expire)
+}
+
+func (c *LRU) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
 }
 
 func (c *LRU) SetRemover(remover strategy.EntryRemover) {
@@ -99,6 +126,7 @@ func (c *LRU) removeElement(ele *list.Element) {
 	c.ll.Remove(ele)
 	kv := ele.Value.(*entry)
 	delete(c.cache, kv.key)
+	c.expiry.Remove(kv.key)
 	if c.OnEvicted != nil {
 		c.OnEvicted(kv.key, kv.value)
 	}
@@ -106,3 +134,10 @@ func (c *LRU) removeElement(ele *list.Element) {
 		c.remover.OnEntryRemoved(kv.key, kv.value)
 	}
 }
+
+func (c *LRU) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+	return c.clock.Now()
+}
@@ -0,0 +1,63 @@
+package lru
+
+import (
+	"testing"
+	"time"
+
+	"distributed-cache/strategy"
+)
+
+type value struct {
+	val string
+}
+
+func (v *value) Len() int {
+	return len(v.val)
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+type remover struct {
+	removed []string
+}
+
+func (r *remover) OnEntryRemoved(key string, _ strategy.Value) {
+	r.removed = append(r.removed, key)
+}
+
+func TestLRU_RemoveExpired(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	r := &remover{}
+	lru := New(WithClock(clock))
+	lru.SetRemover(r)
+	lru.Add("key1", &value{"value1"}, clock.now.Add(time.Second))
+	lru.Add("key2", &value{"value2"}, clock.now.Add(time.Minute))
+	lru.Add("key3", &value{"value3"}, time.Time{})
+
+	// 续期后 key1 不应过期
+	lru.Add("key1", &value{"value1"}, clock.now.Add(time.Hour))
+	r.removed = nil
+
+	clock.now = clock.now.Add(2 * time.Minute)
+	if n := lru.RemoveExpired(); n != 1 || len(r.removed) != 1 || r.removed[0] != "key2" {
+		t.Fatalf("expect key2 removed, got %d removed, remover saw %v", n, r.removed)
+	}
+	if _, ok := lru.Get("key1"); !ok {
+		t.Fatalf("key1 was renewed and should exist")
+	}
+
+	lru.Remove("key1")
+	clock.now = clock.now.Add(24 * time.Hour)
+	if n := lru.RemoveExpired(); n != 0 {
+		t.Fatalf("removed key should no longer be tracked, removed %d", n)
+	}
+	if _, ok := lru.Get("key3"); !ok {
+		t.Fatalf("key3 never expires")
+	}
+}
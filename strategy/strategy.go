@@ -12,6 +12,10 @@ type EvictionStrategy interface {
 	Get(key string) (Value, bool)
 	RemoveOldest()
 	Add(key string, value Value, expire time.Time)
+	Remove(key string)
+	// RemoveExpired drops every expired entry and reports how many it
+	// removed.
+	RemoveExpired() int
 	SetRemover(remover EntryRemover)
 }
 